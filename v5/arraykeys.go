@@ -0,0 +1,191 @@
+package jsonpatch
+
+import (
+	"strings"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// mergeDirective is the member of a keyed array merge patch entry that
+// carries instructions other than a plain merge.
+const mergeDirective = "$patch"
+
+// lookupArrayKey returns the identity key path configured for the array at
+// path. Keys of arrayKeys are JSON Pointers in which a "*" token matches any
+// single token. When several patterns match, the most specific one wins: the
+// one whose first "*" comes last, so an exact match takes precedence over
+// any pattern, and "/pods/*" over "/*/containers".
+func lookupArrayKey(arrayKeys map[string]string, path string) (string, bool) {
+	if len(arrayKeys) == 0 {
+		return "", false
+	}
+
+	if key, ok := arrayKeys[path]; ok {
+		return key, true
+	}
+
+	tokens := strings.Split(path, "/")
+
+	var best []string
+	var bestKey string
+
+	for pattern, key := range arrayKeys {
+		split := strings.Split(pattern, "/")
+		if matchPathPattern(split, tokens) && (best == nil || morePrecisePattern(split, best)) {
+			best, bestKey = split, key
+		}
+	}
+
+	return bestKey, best != nil
+}
+
+// morePrecisePattern reports whether the pattern a, which matches the same
+// tokens as b, has a literal token where b first has a "*".
+func morePrecisePattern(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return b[i] == "*"
+		}
+	}
+
+	return false
+}
+
+func matchPathPattern(pattern, tokens []string) bool {
+	if len(pattern) != len(tokens) {
+		return false
+	}
+
+	for i, p := range pattern {
+		if p != "*" && p != tokens[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nodeIdentities returns the identity of every node, as found at keyPath
+// within each of them. It reports false when a node has no identity, or when
+// two nodes share the same identity.
+func nodeIdentities(nodes []*lazyNode, keyPath string, options *ApplyOptions) ([]string, bool) {
+	ids := make([]string, len(nodes))
+	seen := make(map[string]bool, len(nodes))
+
+	for i, n := range nodes {
+		id, ok := nodeIdentity(n, keyPath, options)
+		if !ok || seen[id] {
+			return nil, false
+		}
+
+		seen[id] = true
+		ids[i] = id
+	}
+
+	return ids, true
+}
+
+func nodeIdentity(n *lazyNode, keyPath string, options *ApplyOptions) (string, bool) {
+	if keyPath == "" {
+		return "", false
+	}
+
+	cur := n
+
+	for _, part := range strings.Split(keyPath, "/")[1:] {
+		if nodeKind(cur) != kindObject {
+			return "", false
+		}
+
+		doc, err := cur.intoDoc(options)
+		if err != nil {
+			return "", false
+		}
+
+		next, ok := doc.obj[decodePatchKey(part)]
+		if !ok {
+			return "", false
+		}
+		cur = next
+	}
+
+	id, err := canonicalKey(cur)
+	if err != nil {
+		return "", false
+	}
+
+	return id, true
+}
+
+// valueIdentities is the counterpart of nodeIdentities for decoded values.
+func valueIdentities(values []interface{}, keyPath string) ([]string, bool) {
+	ids := make([]string, len(values))
+	seen := make(map[string]bool, len(values))
+
+	for i, v := range values {
+		id, ok := valueIdentity(v, keyPath)
+		if !ok || seen[id] {
+			return nil, false
+		}
+
+		seen[id] = true
+		ids[i] = id
+	}
+
+	return ids, true
+}
+
+func valueIdentity(v interface{}, keyPath string) (string, bool) {
+	id, ok := valueAtKeyPath(v, keyPath)
+	if !ok {
+		return "", false
+	}
+
+	buf, err := json.Marshal(id)
+	if err != nil {
+		return "", false
+	}
+
+	return string(buf), true
+}
+
+func valueAtKeyPath(v interface{}, keyPath string) (interface{}, bool) {
+	if keyPath == "" {
+		return nil, false
+	}
+
+	cur := v
+
+	for _, part := range strings.Split(keyPath, "/")[1:] {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		cur, ok = obj[decodePatchKey(part)]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// setValueAtKeyPath stores val at keyPath within obj, creating intermediate
+// objects as needed.
+func setValueAtKeyPath(obj map[string]interface{}, keyPath string, val interface{}) {
+	parts := strings.Split(keyPath, "/")[1:]
+
+	for _, part := range parts[:len(parts)-1] {
+		key := decodePatchKey(part)
+
+		next, ok := obj[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			obj[key] = next
+		}
+		obj = next
+	}
+
+	obj[decodePatchKey(parts[len(parts)-1])] = val
+}
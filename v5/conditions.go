@@ -0,0 +1,101 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// conditions decodes the "if" clause of the Operation into the "test"
+// operations it stands for. The clause is either a single test, such as
+// {"path": "/version", "value": 1}, or an array of tests that must all pass.
+// A path in the clause that does not start with "/" is a Relative JSON
+// Pointer, resolved against the path of the Operation.
+func (o Operation) conditions() (Patch, error) {
+	raw, ok := o["if"]
+	if !ok {
+		return nil, nil
+	}
+
+	if raw == nil {
+		return nil, fmt.Errorf("'if' is null: %w", ErrInvalid)
+	}
+
+	var tests Patch
+
+	if isArray(*raw) {
+		if err := unmarshal(*raw, &tests); err != nil {
+			return nil, fmt.Errorf("failed to decode 'if': %v: %w", err, ErrInvalid)
+		}
+	} else {
+		var test Operation
+		if err := unmarshal(*raw, &test); err != nil || test == nil {
+			return nil, fmt.Errorf("failed to decode 'if': %v: %w", err, ErrInvalid)
+		}
+		tests = Patch{test}
+	}
+
+	for i, test := range tests {
+		path, err := test.Path()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode 'if': %w", err)
+		}
+
+		resolved := Operation{}
+		for k, v := range test {
+			resolved[k] = v
+		}
+		resolved["op"] = rawString("test")
+
+		if path != "" && !strings.HasPrefix(path, "/") {
+			r, err := ParseRelativePointer(path)
+			if err != nil {
+				return nil, err
+			}
+
+			context, err := o.PathPointer()
+			if err != nil {
+				return nil, err
+			}
+
+			p, err := r.Resolve(context)
+			if err != nil {
+				return nil, err
+			}
+
+			resolved.SetPath(p)
+		}
+
+		tests[i] = resolved
+	}
+
+	return tests, nil
+}
+
+// conditionHolds reports whether the "if" clause of op passes against the
+// current document, which it does if there is none or if options do not
+// enable ConditionalOperations. A test failing, or finding nothing at its
+// path, makes the clause false.
+func (p Patch) conditionHolds(doc *container, op Operation, options *ApplyOptions) (bool, error) {
+	if !options.ConditionalOperations {
+		return true, nil
+	}
+
+	tests, err := op.conditions()
+	if err != nil {
+		return false, err
+	}
+
+	for _, test := range tests {
+		err := p.test(doc, test, options)
+
+		switch {
+		case errors.Is(err, ErrTestFailed), errors.Is(err, ErrMissing):
+			return false, nil
+		case err != nil:
+			return false, fmt.Errorf("error in 'if': %w", err)
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,200 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+func conditionalOptions() *ApplyOptions {
+	options := NewApplyOptions()
+	options.ConditionalOperations = true
+	return options
+}
+
+func TestConditionalOperations(t *testing.T) {
+	cases := []struct {
+		doc, patch, result string
+	}{
+		{
+			`{"version": 1}`,
+			`[{"op": "replace", "path": "/version", "value": 2, "if": {"path": "/version", "value": 1}}]`,
+			`{"version": 2}`,
+		},
+		{
+			`{"version": 3}`,
+			`[{"op": "replace", "path": "/version", "value": 2, "if": {"path": "/version", "value": 1}}]`,
+			`{"version": 3}`,
+		},
+		{
+			`{}`,
+			`[{"op": "remove", "path": "/a", "if": {"path": "/a/b", "value": 1}}]`,
+			`{}`,
+		},
+		{
+			`{"a": 1, "b": 2}`,
+			`[{"op": "remove", "path": "/a", "if": [{"path": "/a", "value": 1}, {"path": "/b", "value": 3}]},
+			  {"op": "remove", "path": "/b", "if": [{"path": "/a", "value": 1}, {"path": "/b", "value": 2}]}]`,
+			`{"a": 1}`,
+		},
+		{
+			`{"items": [{"on": true, "n": 1}, {"on": false, "n": 1}]}`,
+			`[{"op": "replace", "path": "/items/0/n", "value": 2, "if": {"path": "0/on", "value": false}},
+			  {"op": "replace", "path": "/items/1/n", "value": 2, "if": {"path": "1/on", "value": false}}]`,
+			`{"items": [{"on": true, "n": 1}, {"on": false, "n": 2}]}`,
+		},
+		{
+			`{"a": 1}`,
+			`[{"op": "add", "path": "/b", "value": 1, "if": {"path": "", "value": {"a": 1}}},
+			  {"op": "add", "path": "/c", "value": 1, "if": {"path": "", "value": {"a": 1}}}]`,
+			`{"a": 1, "b": 1}`,
+		},
+		{
+			`[]`,
+			`[{"op": "add", "path": "/0", "value": null},
+			  {"op": "add", "path": "/1", "value": 1, "if": {"path": "/0", "value": "x"}}]`,
+			`[null]`,
+		},
+		{
+			`{}`,
+			`[{"op": "add", "path": "/a", "value": null},
+			  {"op": "add", "path": "/b", "value": 1, "if": {"path": "/a", "value": "x"}}]`,
+			`{"a": null}`,
+		},
+	}
+
+	options := conditionalOptions()
+
+	for _, c := range cases {
+		p, err := DecodePatchWithOptions([]byte(c.patch), options)
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		out, err := p.ApplyWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to apply %s: %s", c.patch, err)
+			continue
+		}
+
+		if !compareJSON(string(out), c.result) {
+			t.Errorf("Applying %s: expected %s, got %s", c.patch, c.result, out)
+		}
+
+		inverse, err := p.InvertWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to invert %s: %s", c.patch, err)
+			continue
+		}
+
+		if back, err := inverse.Apply(out); err != nil || !compareJSON(string(back), c.doc) {
+			t.Errorf("Inverting %s gave %s: %v", c.patch, back, err)
+		}
+	}
+}
+
+func TestConditionalOperationsDisabled(t *testing.T) {
+	patch := `[{"op": "replace", "path": "/version", "value": 2, "if": {"path": "/version", "value": 1}}]`
+
+	p, err := DecodePatch([]byte(patch))
+	if err != nil {
+		t.Fatalf("Unable to decode patch %s: %s", patch, err)
+	}
+
+	out, err := p.Apply([]byte(`{"version": 3}`))
+	if err != nil {
+		t.Fatalf("Unable to apply %s: %s", patch, err)
+	}
+
+	if !compareJSON(string(out), `{"version": 2}`) {
+		t.Errorf("Expected the 'if' member to be ignored, got %s", out)
+	}
+}
+
+func TestConditionalOperationsExpanded(t *testing.T) {
+	options := conditionalOptions()
+	options.AllowWildcards = true
+	options.ExtendedTests = true
+
+	doc := `{"items": [{"n": 1, "tag": "x"}, {"n": 2}, {"n": 3, "tag": "y"}]}`
+	patch := `[{"op": "replace", "path": "/items/*/n", "value": 0, "if": {"path": "1/tag", "exists": true}}]`
+
+	p, err := DecodePatchWithOptions([]byte(patch), options)
+	if err != nil {
+		t.Fatalf("Unable to decode patch %s: %s", patch, err)
+	}
+
+	out, err := p.ApplyWithOptions([]byte(doc), options)
+	if err != nil {
+		t.Fatalf("Unable to apply %s: %s", patch, err)
+	}
+
+	expected := `{"items": [{"n": 0, "tag": "x"}, {"n": 2}, {"n": 0, "tag": "y"}]}`
+	if !compareJSON(string(out), expected) {
+		t.Errorf("Expected %s, got %s", expected, out)
+	}
+}
+
+func TestConditionalOperationsResults(t *testing.T) {
+	patch := `[
+		{"op": "add", "path": "/a", "value": 1, "if": {"path": "/a", "exists": true}},
+		{"op": "add", "path": "/b", "value": 1, "if": {"path": "/b", "value": null}}
+	]`
+
+	options := conditionalOptions()
+	options.ExtendedTests = true
+
+	p, err := DecodePatchWithOptions([]byte(patch), options)
+	if err != nil {
+		t.Fatalf("Unable to decode patch %s: %s", patch, err)
+	}
+
+	out, results, err := p.ApplyWithResults([]byte(`{}`), options)
+	if err != nil {
+		t.Fatalf("Unable to apply %s: %s", patch, err)
+	}
+
+	if !compareJSON(string(out), `{"b": 1}`) {
+		t.Errorf("Unexpected result %s", out)
+	}
+
+	if results[0].Status != OperationSkipped || results[1].Status != OperationApplied {
+		t.Errorf("Unexpected results %v", results)
+	}
+
+	_, journal, err := p.ApplyWithJournal([]byte(`{}`), options)
+	if err != nil {
+		t.Fatalf("Unable to apply %s: %s", patch, err)
+	}
+
+	if len(journal) != 1 || journal[0].Index != 1 {
+		t.Errorf("Expected a single journal entry, got %v", journal)
+	}
+}
+
+func TestConditionalOperationErrors(t *testing.T) {
+	options := conditionalOptions()
+
+	for _, patch := range []string{
+		`[{"op": "remove", "path": "/a", "if": null}]`,
+		`[{"op": "remove", "path": "/a", "if": 1}]`,
+		`[{"op": "remove", "path": "/a", "if": [1]}]`,
+		`[{"op": "remove", "path": "/a", "if": {"value": 1}}]`,
+		`[{"op": "remove", "path": "/a", "if": {"path": "x", "value": 1}}]`,
+	} {
+		if _, err := DecodePatchWithOptions([]byte(patch), options); err == nil {
+			t.Errorf("Expected %s to be rejected", patch)
+		}
+
+		p, err := DecodePatch([]byte(patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", patch, err)
+		}
+
+		_, err = p.ApplyWithOptions([]byte(`{"a": 1}`), options)
+
+		var perr *PatchError
+		if !errors.As(err, &perr) || perr.Index != 0 {
+			t.Errorf("Applying %s: expected a patch error, got %v", patch, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// conformanceCase is a test of the json-patch-tests suite, in
+// testdata/json-patch-tests.
+type conformanceCase struct {
+	Comment  string          `json:"comment"`
+	Doc      json.RawMessage `json:"doc"`
+	Patch    json.RawMessage `json:"patch"`
+	Expected json.RawMessage `json:"expected"`
+	Error    string          `json:"error"`
+	Disabled bool            `json:"disabled"`
+}
+
+// conformanceExpectedFailures lists the tests of the suite a mode is known to
+// fail, by file and position, along with the reason.
+var conformanceExpectedFailures = map[string]map[string]string{
+	"lenient": {
+		"tests.json#19": "negative array indices are supported by default",
+		"tests.json#57": "a test of the empty-string member gets the whole document",
+		"tests.json#58": "a test of the empty-string member gets the whole document",
+		"tests.json#79": "a test without a value compares against null",
+		"tests.json#87": "array indices may have leading zeros",
+		"tests.json#88": "array indices may have leading zeros",
+	},
+}
+
+func TestConformance(t *testing.T) {
+	modes := map[string]func() *ApplyOptions{
+		"lenient": NewApplyOptions,
+		"strict": func() *ApplyOptions {
+			options := NewApplyOptions()
+			options.Strict = true
+			return options
+		},
+	}
+
+	for _, file := range []string{"spec_tests.json", "tests.json"} {
+		buf, err := os.ReadFile(filepath.Join("testdata", "json-patch-tests", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var cases []conformanceCase
+		if err := json.Unmarshal(buf, &cases); err != nil {
+			t.Fatalf("Unable to decode %s: %s", file, err)
+		}
+
+		for mode, newOptions := range modes {
+			for i, c := range cases {
+				id := fmt.Sprintf("%s#%d", file, i)
+
+				t.Run(fmt.Sprintf("%s/%s/%s", mode, id, c.Comment), func(t *testing.T) {
+					if c.Disabled {
+						t.Skip("disabled by the suite")
+					}
+
+					err := runConformanceCase(c, newOptions())
+
+					reason, expected := conformanceExpectedFailures[mode][id]
+					switch {
+					case expected && err == nil:
+						t.Errorf("Expected failure passes, remove it from the list: %s", reason)
+					case expected:
+						t.Logf("Known deviation: %s: %s", reason, err)
+					case err != nil:
+						t.Error(err)
+					}
+				})
+			}
+		}
+	}
+}
+
+// runConformanceCase returns an error if applying the patch of c with options
+// does not have the outcome c expects.
+func runConformanceCase(c conformanceCase, options *ApplyOptions) error {
+	var p Patch
+	var err error
+
+	if options.Strict {
+		p, err = DecodePatchWithOptions(c.Patch, options)
+	} else {
+		p, err = DecodePatch(c.Patch)
+	}
+
+	var out []byte
+	if err == nil {
+		out, err = p.ApplyWithOptions(c.Doc, options)
+	}
+
+	if c.Error != "" {
+		if err == nil {
+			return fmt.Errorf("expected an error (%s), got %s", c.Error, out)
+		}
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unexpected error: %w", err)
+	}
+
+	if c.Expected != nil && !compareJSON(string(out), string(c.Expected)) {
+		return fmt.Errorf("expected %s, got %s", c.Expected, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package jsonpatch
+
+import (
+	"fmt"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// OperationHandler applies an operation of a custom kind to the location its
+// path refers to. A handler returning an error should leave the target
+// unchanged.
+type OperationHandler func(op Operation, target *OperationTarget) error
+
+// RegisterOperation makes the functions taking these options apply the
+// operations of the passed in kind with handler, and DecodePatchWithOptions
+// accept them. The kinds defined by RFC 6902 cannot be overridden, and
+// registering one of them panics.
+func (o *ApplyOptions) RegisterOperation(kind string, handler OperationHandler) {
+	switch kind {
+	case "add", "remove", "replace", "move", "copy", "test":
+		panic(fmt.Sprintf("jsonpatch: cannot register the RFC 6902 operation %q", kind))
+	}
+
+	if o.CustomOperations == nil {
+		o.CustomOperations = map[string]OperationHandler{}
+	}
+
+	o.CustomOperations[kind] = handler
+}
+
+// OperationTarget is the location the path of a custom operation refers to:
+// a member of an object, an element of an array, or the whole document.
+type OperationTarget struct {
+	pd      *container
+	con     container
+	key     string
+	options *ApplyOptions
+}
+
+// Key returns the member name or array index of the target, or "" for the
+// whole document.
+func (t *OperationTarget) Key() string {
+	return t.key
+}
+
+// IsRoot reports whether the target is the whole document.
+func (t *OperationTarget) IsRoot() bool {
+	return t.con == nil
+}
+
+// InArray reports whether the target is an element of an array.
+func (t *OperationTarget) InArray() bool {
+	_, ok := t.con.(*partialArray)
+	return ok
+}
+
+// Exists reports whether the target holds a value.
+func (t *OperationTarget) Exists() bool {
+	if t.IsRoot() {
+		return true
+	}
+
+	_, err := t.con.get(t.key, t.options)
+	return err == nil
+}
+
+// Get returns the JSON encoded value of the target.
+func (t *OperationTarget) Get() ([]byte, error) {
+	if t.IsRoot() {
+		return json.MarshalEscaped(*t.pd, false)
+	}
+
+	val, err := t.con.get(t.key, t.options)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalEscaped(val, false)
+}
+
+// Set stores the JSON encoded value at the target, which is added to its
+// object if missing. An array element must already exist.
+func (t *OperationTarget) Set(value []byte) error {
+	if !json.Valid(value) {
+		return fmt.Errorf("value is not valid JSON: %w", ErrInvalid)
+	}
+
+	if t.IsRoot() {
+		pd, err := newContainer(value, t.options)
+		if err != nil {
+			return err
+		}
+
+		*t.pd = pd
+		return nil
+	}
+
+	return t.con.set(t.key, newLazyNode(newRawMessage(value)), t.options)
+}
+
+// Remove removes the target from its object or array.
+func (t *OperationTarget) Remove() error {
+	if t.IsRoot() {
+		return fmt.Errorf("unable to remove the whole document: %w", ErrInvalid)
+	}
+
+	return t.con.remove(t.key, t.options)
+}
+
+// custom applies an operation of a kind registered in options.
+func (p Patch) custom(doc *container, op Operation, handler OperationHandler, options *ApplyOptions) error {
+	kind := op.Kind()
+
+	path, err := op.Path()
+	if err != nil {
+		return fmt.Errorf("%s operation failed to decode path: %w", kind, ErrMissing)
+	}
+
+	target := &OperationTarget{pd: doc, options: options}
+
+	if path != "" {
+		con, key := findObject(doc, path, options)
+
+		if con == nil {
+			return fmt.Errorf("%s operation does not apply: doc is missing path: %s: %w", kind, path, ErrMissing)
+		}
+
+		target.con, target.key = con, key
+	}
+
+	if err := handler(op, target); err != nil {
+		return fmt.Errorf("error in %s for path: '%s': %w", kind, path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var errNotANumber = errors.New("not a number")
+
+// decodeValue decodes the value of op, if it has one.
+func decodeValue(op Operation, v interface{}) error {
+	raw, ok := op["value"]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	return json.Unmarshal(*raw, v)
+}
+
+func incrementHandler(op Operation, target *OperationTarget) error {
+	buf, err := target.Get()
+	if err != nil {
+		return err
+	}
+
+	var n int
+	if err := json.Unmarshal(buf, &n); err != nil {
+		return errNotANumber
+	}
+
+	by := 1
+	if err := decodeValue(op, &by); err != nil {
+		return err
+	}
+	n += by
+
+	out, _ := json.Marshal(n)
+	return target.Set(out)
+}
+
+func appendUniqueHandler(op Operation, target *OperationTarget) error {
+	var values []interface{}
+
+	if target.Exists() {
+		buf, err := target.Get()
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(buf, &values); err != nil {
+			return err
+		}
+	}
+
+	var v interface{}
+	if err := decodeValue(op, &v); err != nil {
+		return err
+	}
+
+	for _, x := range values {
+		if x == v {
+			return nil
+		}
+	}
+
+	out, _ := json.Marshal(append(values, v))
+	return target.Set(out)
+}
+
+func dropHandler(op Operation, target *OperationTarget) error {
+	if !target.Exists() {
+		return nil
+	}
+
+	return target.Remove()
+}
+
+func customOptions() *ApplyOptions {
+	options := NewApplyOptions()
+	options.RegisterOperation("increment", incrementHandler)
+	options.RegisterOperation("append-unique", appendUniqueHandler)
+	options.RegisterOperation("drop", dropHandler)
+	return options
+}
+
+func TestCustomOperations(t *testing.T) {
+	cases := []struct {
+		doc, patch, result string
+	}{
+		{
+			`{"a": 1}`,
+			`[{"op": "increment", "path": "/a"}, {"op": "increment", "path": "/a", "value": 5}]`,
+			`{"a": 7}`,
+		},
+		{
+			`{"a": [1, 2]}`,
+			`[{"op": "increment", "path": "/a/-1"}]`,
+			`{"a": [1, 3]}`,
+		},
+		{
+			`{"tags": ["a"]}`,
+			`[{"op": "append-unique", "path": "/tags", "value": "b"}, {"op": "append-unique", "path": "/tags", "value": "a"}]`,
+			`{"tags": ["a", "b"]}`,
+		},
+		{
+			`{}`,
+			`[{"op": "append-unique", "path": "/tags", "value": "a"}]`,
+			`{"tags": ["a"]}`,
+		},
+		{
+			`{"a": [1, 2, 3], "b": 1}`,
+			`[{"op": "drop", "path": "/a/1"}, {"op": "drop", "path": "/b"}, {"op": "drop", "path": "/c"}]`,
+			`{"a": [1, 3]}`,
+		},
+		{
+			`[1]`,
+			`[{"op": "append-unique", "path": "", "value": 2}]`,
+			`[1, 2]`,
+		},
+	}
+
+	options := customOptions()
+
+	for _, c := range cases {
+		if _, err := DecodePatch([]byte(c.patch)); err == nil {
+			t.Errorf("Expected DecodePatch to reject %s", c.patch)
+		}
+
+		p, err := DecodePatchWithOptions([]byte(c.patch), options)
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		out, err := p.ApplyWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to apply %s: %s", c.patch, err)
+			continue
+		}
+
+		if !compareJSON(string(out), c.result) {
+			t.Errorf("Applying %s: expected %s, got %s", c.patch, c.result, out)
+		}
+
+		inverse, err := p.InvertWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to invert %s: %s", c.patch, err)
+			continue
+		}
+
+		if back, err := inverse.Apply(out); err != nil || !compareJSON(string(back), c.doc) {
+			t.Errorf("Inverting %s gave %s: %v", c.patch, back, err)
+		}
+	}
+}
+
+func TestCustomOperationErrors(t *testing.T) {
+	options := customOptions()
+
+	cases := []struct {
+		patch string
+		err   error
+	}{
+		{`[{"op": "increment", "path": "/b"}]`, errNotANumber},
+		{`[{"op": "increment", "path": "/x/y"}]`, ErrMissing},
+		{`[{"op": "increment", "path": "/c/5"}]`, ErrInvalidIndex},
+	}
+
+	for _, c := range cases {
+		p, err := DecodePatchWithOptions([]byte(c.patch), options)
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		_, err = p.ApplyWithOptions([]byte(`{"a": 1, "b": "x", "c": []}`), options)
+
+		var perr *PatchError
+		if !errors.As(err, &perr) || perr.Op != "increment" || !errors.Is(err, c.err) {
+			t.Errorf("Applying %s: expected %v, got %v", c.patch, c.err, err)
+		}
+	}
+
+	p := Patch{newOperation("increment", "/a")}
+	if _, err := p.Apply([]byte(`{"a": 1}`)); err == nil {
+		t.Errorf("Expected an unregistered kind to be rejected")
+	}
+}
+
+func TestRegisterStandardOperation(t *testing.T) {
+	for _, kind := range []string{"add", "remove", "replace", "move", "copy", "test"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected registering %q to panic", kind)
+				}
+			}()
+
+			NewApplyOptions().RegisterOperation(kind, dropHandler)
+		}()
+	}
+}
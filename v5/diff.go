@@ -0,0 +1,748 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+const (
+	kindNull = iota
+	kindScalar
+	kindObject
+	kindArray
+)
+
+// DiffOptions specifies options for calls to CreatePatchWithOptions.
+// Use NewDiffOptions to obtain default values for DiffOptions.
+type DiffOptions struct {
+	// DetectMoves emits a "move" operation when a removed value reappears
+	// unchanged at another path, instead of a "remove" and an "add".
+	// Default to true.
+	DetectMoves bool
+	// DetectCopies emits a "copy" operation when an added value is already
+	// present unchanged elsewhere in the original document.
+	// Default to false.
+	DetectCopies bool
+	// ArrayKeys matches the elements of arrays of objects by identity instead
+	// of by position. It maps the JSON Pointer of an array, in which "*"
+	// matches any single token, to the JSON Pointer of the identity key within
+	// each element, such as "/name". Arrays whose elements lack the key or
+	// share a key are diffed by position. When several patterns match an
+	// array, the one with the most literal tokens before its first "*" is
+	// used.
+	// Default to nil.
+	ArrayKeys map[string]string
+}
+
+// NewDiffOptions creates a default set of options for calls to
+// CreatePatchWithOptions.
+func NewDiffOptions() *DiffOptions {
+	return &DiffOptions{
+		DetectMoves:  true,
+		DetectCopies: false,
+	}
+}
+
+// diffOp is an operation produced while diffing. For "remove" operations
+// value holds the removed value, so that it can later be matched against
+// added values.
+type diffOp struct {
+	kind  string
+	path  string
+	from  string
+	value *lazyNode
+}
+
+// differ accumulates the operations needed to turn one document into
+// another.
+type differ struct {
+	ops     []diffOp
+	options *ApplyOptions
+	diffOpt *DiffOptions
+}
+
+// CreatePatch creates an RFC 6902 patch that converts the original document
+// into the modified document. Applying the returned patch to the original
+// document yields a document equal to the modified one.
+//
+// The paths of the patch are RFC 6901 JSON Pointers, in which an empty token
+// names the member "". When the documents have such members, the patch must
+// be applied with ApplyOptions.Strict set, as other options resolve an empty
+// token to its parent.
+func CreatePatch(originalJSON, modifiedJSON []byte) (Patch, error) {
+	return CreatePatchWithOptions(originalJSON, modifiedJSON, NewDiffOptions())
+}
+
+// CreatePatchWithOptions creates an RFC 6902 patch that converts the original
+// document into the modified document, according to the passed in DiffOptions.
+func CreatePatchWithOptions(originalJSON, modifiedJSON []byte, options *DiffOptions) (Patch, error) {
+	if !json.Valid(originalJSON) || !json.Valid(modifiedJSON) {
+		return nil, ErrBadJSONDoc
+	}
+
+	d := &differ{
+		options: queryOptions(),
+		diffOpt: options,
+	}
+
+	original := newLazyNode(newRawMessage(originalJSON))
+	modified := newLazyNode(newRawMessage(modifiedJSON))
+
+	if err := d.diff("", original, modified); err != nil {
+		return nil, err
+	}
+
+	if options.DetectMoves {
+		if err := d.detectMoves(); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.DetectCopies {
+		if err := d.detectCopies(original); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.patch()
+}
+
+func nodeKind(n *lazyNode) int {
+	if n == nil {
+		return kindNull
+	}
+
+	switch n.which {
+	case eDoc:
+		return kindObject
+	case eAry:
+		return kindArray
+	}
+
+	if n.raw == nil || len(*n.raw) == 0 {
+		return kindNull
+	}
+
+	switch n.nextByte() {
+	case '{':
+		return kindObject
+	case '[':
+		return kindArray
+	case 'n':
+		return kindNull
+	}
+
+	return kindScalar
+}
+
+func (d *differ) diff(path string, a, b *lazyNode) error {
+	ak := nodeKind(a)
+	bk := nodeKind(b)
+
+	switch {
+	case ak == kindObject && bk == kindObject:
+		return d.diffObjects(path, a, b)
+	case ak == kindArray && bk == kindArray:
+		return d.diffArrays(path, a, b)
+	case ak == kindNull && bk == kindNull:
+		return nil
+	case ak == kindScalar && bk == kindScalar && a.equal(b):
+		return nil
+	}
+
+	d.replace(path, b)
+	return nil
+}
+
+func (d *differ) diffObjects(path string, a, b *lazyNode) error {
+	ad, err := a.intoDoc(d.options)
+	if err != nil {
+		return err
+	}
+
+	bd, err := b.intoDoc(d.options)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range ad.keys {
+		child := path + "/" + encodePatchKey(k)
+
+		bv, ok := bd.obj[k]
+		if !ok {
+			d.remove(child, ad.obj[k])
+			continue
+		}
+
+		if err := d.diff(child, ad.obj[k], bv); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range bd.keys {
+		if _, ok := ad.obj[k]; ok {
+			continue
+		}
+
+		d.add(path+"/"+encodePatchKey(k), bd.obj[k])
+	}
+
+	return nil
+}
+
+// lcsMaxCells bounds the size of the table used to compute the longest
+// common subsequence of two arrays. Larger arrays are compared by position.
+const lcsMaxCells = 1 << 22
+
+func (d *differ) diffArrays(path string, a, b *lazyNode) error {
+	aa, err := a.intoAry()
+	if err != nil {
+		return err
+	}
+
+	ba, err := b.intoAry()
+	if err != nil {
+		return err
+	}
+
+	an, bn := aa.nodes, ba.nodes
+
+	if keyPath, ok := lookupArrayKey(d.diffOpt.ArrayKeys, path); ok {
+		if done, err := d.diffArraysByKey(path, keyPath, an, bn); done || err != nil {
+			return err
+		}
+	}
+
+	ak, err := canonicalKeys(an)
+	if err != nil {
+		return err
+	}
+
+	bk, err := canonicalKeys(bn)
+	if err != nil {
+		return err
+	}
+
+	// Elements shared at the head and tail of both arrays never need an
+	// operation, so only the middle section takes part in the LCS.
+	start := 0
+	for start < len(an) && start < len(bn) && ak[start] == bk[start] {
+		start++
+	}
+
+	endA, endB := len(an), len(bn)
+	for endA > start && endB > start && ak[endA-1] == bk[endB-1] {
+		endA--
+		endB--
+	}
+
+	an, bn = an[start:endA], bn[start:endB]
+	ak, bk = ak[start:endA], bk[start:endB]
+
+	if len(an)*len(bn) > lcsMaxCells {
+		return d.diffArraysByPosition(path, start, an, bn)
+	}
+
+	lcs := lcsTable(ak, bk)
+	width := len(bk) + 1
+
+	// idx is the position in the array as it looks after all operations
+	// emitted so far have been applied.
+	idx := start
+	i, j := 0, 0
+
+	for i < len(an) || j < len(bn) {
+		switch {
+		case i < len(an) && j < len(bn) && ak[i] == bk[j]:
+			idx++
+			i++
+			j++
+		case i < len(an) && j < len(bn) && lcs[i*width+j] == lcs[(i+1)*width+j+1]:
+			// Neither element is part of the common subsequence, so
+			// change the element in place.
+			if err := d.diff(path+"/"+strconv.Itoa(idx), an[i], bn[j]); err != nil {
+				return err
+			}
+			idx++
+			i++
+			j++
+		case j == len(bn) || (i < len(an) && lcs[(i+1)*width+j] >= lcs[i*width+j+1]):
+			d.remove(path+"/"+strconv.Itoa(idx), an[i])
+			i++
+		default:
+			d.add(path+"/"+strconv.Itoa(idx), bn[j])
+			idx++
+			j++
+		}
+	}
+
+	return nil
+}
+
+// diffArraysByKey matches the elements of both arrays by their identity at
+// keyPath. Elements missing from b are removed first, then the remaining and
+// new elements are moved or added into the order of b, and each matched
+// element is diffed in its final position. It reports false if the elements
+// cannot be matched by identity.
+func (d *differ) diffArraysByKey(path, keyPath string, an, bn []*lazyNode) (bool, error) {
+	aids, ok := nodeIdentities(an, keyPath, d.options)
+	if !ok {
+		return false, nil
+	}
+
+	bids, ok := nodeIdentities(bn, keyPath, d.options)
+	if !ok {
+		return false, nil
+	}
+
+	wanted := make(map[string]bool, len(bids))
+	for _, id := range bids {
+		wanted[id] = true
+	}
+
+	// cur holds the indices in an of the elements as they are laid out after
+	// the operations emitted so far, -1 marks an added element.
+	cur := make([]int, 0, len(an))
+
+	for i := len(an) - 1; i >= 0; i-- {
+		if !wanted[aids[i]] {
+			d.remove(path+"/"+strconv.Itoa(i), an[i])
+		}
+	}
+
+	for i := range an {
+		if wanted[aids[i]] {
+			cur = append(cur, i)
+		}
+	}
+
+	for j, id := range bids {
+		pos := -1
+		for p := j; p < len(cur); p++ {
+			if cur[p] >= 0 && aids[cur[p]] == id {
+				pos = p
+				break
+			}
+		}
+
+		if pos == -1 {
+			d.add(path+"/"+strconv.Itoa(j), bn[j])
+			cur = append(cur[:j], append([]int{-1}, cur[j:]...)...)
+			continue
+		}
+
+		i := cur[pos]
+
+		if pos != j {
+			d.ops = append(d.ops, diffOp{
+				kind: "move",
+				path: path + "/" + strconv.Itoa(j),
+				from: path + "/" + strconv.Itoa(pos),
+			})
+			copy(cur[j+1:pos+1], cur[j:pos])
+			cur[j] = i
+		}
+
+		if err := d.diff(path+"/"+strconv.Itoa(j), an[i], bn[j]); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+func (d *differ) diffArraysByPosition(path string, start int, an, bn []*lazyNode) error {
+	common := len(an)
+	if len(bn) < common {
+		common = len(bn)
+	}
+
+	for i := 0; i < common; i++ {
+		if err := d.diff(path+"/"+strconv.Itoa(start+i), an[i], bn[i]); err != nil {
+			return err
+		}
+	}
+
+	// Remove from the end so that the remaining indices stay valid.
+	for i := len(an) - 1; i >= common; i-- {
+		d.remove(path+"/"+strconv.Itoa(start+i), an[i])
+	}
+
+	for i := common; i < len(bn); i++ {
+		d.add(path+"/"+strconv.Itoa(start+i), bn[i])
+	}
+
+	return nil
+}
+
+// lcsTable returns a flattened (len(a)+1) x (len(b)+1) table where the cell
+// at i, j holds the length of the longest common subsequence of a[i:] and
+// b[j:].
+func lcsTable(a, b []string) []int32 {
+	width := len(b) + 1
+	table := make([]int32, (len(a)+1)*width)
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				table[i*width+j] = table[(i+1)*width+j+1] + 1
+			case table[(i+1)*width+j] >= table[i*width+j+1]:
+				table[i*width+j] = table[(i+1)*width+j]
+			default:
+				table[i*width+j] = table[i*width+j+1]
+			}
+		}
+	}
+
+	return table
+}
+
+// canonicalKeys returns a canonical encoding of every node, such that two
+// nodes have the same key exactly when they are structurally equal.
+func canonicalKeys(nodes []*lazyNode) ([]string, error) {
+	keys := make([]string, len(nodes))
+
+	for i, n := range nodes {
+		key, err := canonicalKey(n)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+
+	return keys, nil
+}
+
+func canonicalKey(n *lazyNode) (string, error) {
+	buf, err := json.MarshalEscaped(n, false)
+	if err != nil {
+		return "", err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+
+	// Maps are encoded with sorted keys, which makes the result independent
+	// of the key order in the source document.
+	buf, err = json.MarshalEscaped(v, false)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+func (d *differ) add(path string, val *lazyNode) {
+	d.ops = append(d.ops, diffOp{kind: "add", path: path, value: val})
+}
+
+func (d *differ) replace(path string, val *lazyNode) {
+	d.ops = append(d.ops, diffOp{kind: "replace", path: path, value: val})
+}
+
+func (d *differ) remove(path string, old *lazyNode) {
+	d.ops = append(d.ops, diffOp{kind: "remove", path: path, value: old})
+}
+
+// detectMoves turns a "remove" followed by an "add" of the same value into a
+// single "move" placed where the "add" was. This is only done when none of
+// the operations in between depend on the removed path, as they were
+// computed assuming the value was already gone.
+func (d *differ) detectMoves() error {
+	keys := make([]string, len(d.ops))
+
+	for i, op := range d.ops {
+		if op.kind != "add" && op.kind != "remove" {
+			continue
+		}
+
+		key, err := canonicalKey(op.value)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	dropped := make([]bool, len(d.ops))
+
+	for k := range d.ops {
+		if d.ops[k].kind != "add" {
+			continue
+		}
+
+		for r := 0; r < k; r++ {
+			if dropped[r] || d.ops[r].kind != "remove" || keys[r] != keys[k] {
+				continue
+			}
+
+			from := d.ops[r].path
+			if isProperPathPrefix(from, d.ops[k].path) || d.touchesBetween(from, r, k, dropped) {
+				continue
+			}
+
+			dropped[r] = true
+			d.ops[k] = diffOp{kind: "move", path: d.ops[k].path, from: from}
+			break
+		}
+	}
+
+	ops := d.ops[:0]
+	for i, op := range d.ops {
+		if !dropped[i] {
+			ops = append(ops, op)
+		}
+	}
+	d.ops = ops
+
+	return nil
+}
+
+// detectCopies turns an "add" of a value that is already present in the
+// original document into a "copy" from that location, provided that no
+// earlier operation changes or shifts the source path.
+func (d *differ) detectCopies(original *lazyNode) error {
+	wanted := map[string]bool{}
+	keys := make([]string, len(d.ops))
+
+	for i, op := range d.ops {
+		if op.kind != "add" {
+			continue
+		}
+
+		key, err := canonicalKey(op.value)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+		wanted[key] = true
+	}
+
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	sources := map[string][]string{}
+	if err := d.collectSources(original, "", wanted, sources); err != nil {
+		return err
+	}
+
+	for k, op := range d.ops {
+		if op.kind != "add" {
+			continue
+		}
+
+		for _, from := range sources[keys[k]] {
+			// A copy is only worth it when it is shorter than the value.
+			if len(from) >= len(keys[k]) {
+				continue
+			}
+
+			if isProperPathPrefix(from, op.path) || d.touchesBetween(from, -1, k, nil) {
+				continue
+			}
+
+			d.ops[k] = diffOp{kind: "copy", path: op.path, from: from}
+			break
+		}
+	}
+
+	return nil
+}
+
+// collectSources records the paths of all values below n whose canonical key
+// is in wanted. The document root itself is never recorded.
+func (d *differ) collectSources(n *lazyNode, path string, wanted map[string]bool, sources map[string][]string) error {
+	if path != "" {
+		key, err := canonicalKey(n)
+		if err != nil {
+			return err
+		}
+
+		if wanted[key] {
+			sources[key] = append(sources[key], path)
+		}
+	}
+
+	switch nodeKind(n) {
+	case kindObject:
+		doc, err := n.intoDoc(d.options)
+		if err != nil {
+			return err
+		}
+
+		for _, k := range doc.keys {
+			if err := d.collectSources(doc.obj[k], path+"/"+encodePatchKey(k), wanted, sources); err != nil {
+				return err
+			}
+		}
+	case kindArray:
+		ary, err := n.intoAry()
+		if err != nil {
+			return err
+		}
+
+		for i, v := range ary.nodes {
+			if err := d.collectSources(v, path+"/"+strconv.Itoa(i), wanted, sources); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// touchesBetween reports whether any operation strictly between the indices
+// lo and hi reads, changes or shifts the value at path.
+func (d *differ) touchesBetween(path string, lo, hi int, dropped []bool) bool {
+	for i := lo + 1; i < hi; i++ {
+		if dropped != nil && dropped[i] {
+			continue
+		}
+
+		op := d.ops[i]
+		if pathsInteract(path, op.path) {
+			return true
+		}
+
+		if op.from != "" && pathsInteract(path, op.from) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pathsInteract reports whether an operation on other may change the value
+// at path, or the location of that value. Any token that looks like an array
+// index is treated as one, so that inserting into or removing from that
+// array is assumed to shift path.
+func pathsInteract(path, other string) bool {
+	if path == other || isProperPathPrefix(path, other) || isProperPathPrefix(other, path) {
+		return true
+	}
+
+	tokens := strings.Split(path, "/")
+	otherTokens := strings.Split(other, "/")
+
+	for i := 1; i < len(tokens) && i < len(otherTokens); i++ {
+		token, otherToken := tokens[i], otherTokens[i]
+
+		if !isIndexToken(token) || !isIndexToken(otherToken) {
+			if token != otherToken {
+				return false
+			}
+			continue
+		}
+
+		// Both paths go through the same array. Inserting or removing one
+		// of its elements shifts the indices of all the others.
+		if i == len(tokens)-1 || i == len(otherTokens)-1 {
+			return true
+		}
+
+		// Indices counted from the end of the array may refer to the same
+		// element as any other index.
+		if token != otherToken && token[0] != '-' && otherToken[0] != '-' {
+			return false
+		}
+	}
+
+	return false
+}
+
+func isProperPathPrefix(prefix, path string) bool {
+	return len(path) > len(prefix) && strings.HasPrefix(path, prefix) && path[len(prefix)] == '/'
+}
+
+// isIndexToken reports whether token may be an array index, including a
+// negative index or "-".
+func isIndexToken(token string) bool {
+	if token == "-" {
+		return true
+	}
+
+	if strings.HasPrefix(token, "-") {
+		token = token[1:]
+	}
+
+	if token == "" {
+		return false
+	}
+
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d *differ) patch() (Patch, error) {
+	patch := make(Patch, 0, len(d.ops))
+
+	for _, op := range d.ops {
+		switch op.kind {
+		case "add", "replace":
+			value, err := json.MarshalEscaped(op.value, false)
+			if err != nil {
+				return nil, err
+			}
+			patch = append(patch, newValueOperation(op.kind, op.path, value))
+		case "move", "copy":
+			patch = append(patch, newFromOperation(op.kind, op.from, op.path))
+		default:
+			patch = append(patch, newOperation(op.kind, op.path))
+		}
+	}
+
+	return patch, nil
+}
+
+func newOperation(kind, path string) Operation {
+	return Operation{
+		"op":   rawString(kind),
+		"path": rawString(path),
+	}
+}
+
+func newValueOperation(kind, path string, value []byte) Operation {
+	op := newOperation(kind, path)
+	op["value"] = newRawMessage(value)
+	return op
+}
+
+func newFromOperation(kind, from, path string) Operation {
+	op := newOperation(kind, path)
+	op["from"] = rawString(from)
+	return op
+}
+
+func rawString(s string) *json.RawMessage {
+	// Marshalling a string cannot fail.
+	buf, _ := json.MarshalEscaped(s, false)
+	return newRawMessage(buf)
+}
+
+// From http://tools.ietf.org/html/rfc6901#section-3 :
+//
+// Because the characters '~' and '/' have special meanings in JSON
+// Pointer, '~' needs to be encoded as '~0' and '/' needs to be encoded
+// as '~1' when these characters appear in a reference token.
+
+var (
+	rfc6901Encoder = strings.NewReplacer("~", "~0", "/", "~1")
+)
+
+func encodePatchKey(k string) string {
+	return rfc6901Encoder.Replace(k)
+}
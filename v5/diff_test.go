@@ -0,0 +1,353 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type diffCase struct {
+	name, original, modified string
+}
+
+var DiffCases = []diffCase{
+	{"identical", `{"a": 1, "b": [1, 2]}`, `{"b": [1, 2], "a": 1}`},
+	{"add key", `{"a": 1}`, `{"a": 1, "b": {"c": true}}`},
+	{"remove key", `{"a": 1, "b": 2}`, `{"a": 1}`},
+	{"replace scalar", `{"a": 1}`, `{"a": "1"}`},
+	{"replace with null", `{"a": {"b": 1}}`, `{"a": null}`},
+	{"replace null", `{"a": null}`, `{"a": [1]}`},
+	{"nested object", `{"a": {"b": {"c": 1, "d": 2}}}`, `{"a": {"b": {"c": 3}}}`},
+	{"escaped keys", `{"a/b": 1, "m~n": 2}`, `{"a/b": 2, "m~n": 3, "~/": 4}`},
+	{"empty key", `{"": 1}`, `{"": 2}`},
+	{"empty key object", `{"": {"a": 1}}`, `{"": {"a": 2, "": 3}}`},
+	{"empty key array", `{"": [1, 2]}`, `{"": [1, 3, 2]}`},
+	{"empty key duplicate", `{"": {"a": [1, 2, 3]}}`, `{"": {"a": [1, 2, 3]}, "c": {"a": [1, 2, 3]}}`},
+	{"empty key moved", `{"": {"": [1, 2, 3]}}`, `{"x": [1, 2, 3], "": {}}`},
+	{"grow array", `{"a": [1, 2]}`, `{"a": [1, 2, 3, 4]}`},
+	{"shrink array", `{"a": [1, 2, 3, 4]}`, `{"a": [1]}`},
+	{"array of objects", `[{"a": 1}, {"b": 2}]`, `[{"a": 2}, {"b": 2, "c": 3}]`},
+	{"object to array", `{"a": {"b": 1}}`, `{"a": ["b", 1]}`},
+	{"root object to array", `{"a": 1}`, `[1]`},
+	{"large number", `{"a": 1}`, `{"a": 12345678901234567890}`},
+	{"insert into array", `[1, 2, 3]`, `[0, 1, 2, 2.5, 3, 4]`},
+	{"remove from array", `[0, 1, 2, 3, 4, 5]`, `[1, 3, 5]`},
+	{"reverse array", `[1, 2, 3, 4, 5]`, `[5, 4, 3, 2, 1]`},
+	{"interleave arrays", `["a", "b", "c", "d"]`, `["x", "b", "y", "d", "z"]`},
+	{"nested arrays", `[[1, 2], [3, 4]]`, `[[1, 2, 3], [4]]`},
+	{"rename key", `{"a": {"b": [1, 2, 3]}}`, `{"c": {"b": [1, 2, 3]}}`},
+	{"move between objects", `{"a": {"x": [1, 2]}, "b": {}}`, `{"a": {}, "b": {"y": [1, 2]}}`},
+	{"move into own child", `{"a": {"b": 1}}`, `{"a": {"c": {"b": 1}}}`},
+	{"rotate array", `[1, 2, 3, 4]`, `[2, 3, 4, 1]`},
+	{"move out of array", `{"a": [{"x": 1}, 2, 3], "b": 4}`, `{"a": [2, 3], "b": 4, "c": {"x": 1}}`},
+	{"move with shifted siblings", `[{"x": 1}, [2], [3], 4]`, `[[2, 5], [3], 4, {"x": 1}]`},
+	{"duplicate value", `{"a": {"b": [1, 2, 3]}}`, `{"a": {"b": [1, 2, 3]}, "c": {"b": [1, 2, 3]}}`},
+	{"duplicate changed value", `{"a": {"b": [1, 2, 3]}}`, `{"a": {"b": [1, 2]}, "c": {"b": [1, 2, 3]}}`},
+	{"duplicate array element", `[{"a": "long"}, 2]`, `[3, {"a": "long"}, 2, {"a": "long"}]`},
+	{"html characters", `{"a": "x"}`, `{"a": "<b>&</b>"}`},
+}
+
+func TestCreatePatch(t *testing.T) {
+	options := []*DiffOptions{
+		{},
+		NewDiffOptions(),
+		{DetectMoves: true, DetectCopies: true},
+	}
+
+	for _, o := range options {
+		for _, c := range DiffCases {
+			t.Run(fmt.Sprintf("%s %+v", c.name, *o), func(t *testing.T) {
+				testCreatePatch(t, c, o)
+			})
+		}
+	}
+}
+
+func testCreatePatch(t *testing.T, c diffCase, options *DiffOptions) {
+	patch, err := CreatePatchWithOptions([]byte(c.original), []byte(c.modified), options)
+	if err != nil {
+		t.Fatalf("Unable to create patch: %s", err)
+	}
+
+	strict := NewApplyOptions()
+	strict.Strict = true
+
+	for _, o := range []*ApplyOptions{NewApplyOptions(), strict} {
+		// Paths through "" members only resolve in strict mode.
+		if !o.Strict && strings.Contains(c.original+c.modified, `""`) {
+			continue
+		}
+
+		out, err := patch.ApplyWithOptions([]byte(c.original), o)
+		if err != nil {
+			t.Fatalf("Unable to apply created patch: %s", err)
+		}
+
+		if !compareJSON(string(out), c.modified) {
+			t.Errorf("Created patch did not produce the modified document. Expected:\n%s\n\nActual:\n%s",
+				reformatJSON(c.modified), reformatJSON(string(out)))
+		}
+	}
+}
+
+func TestCreatePatchOperations(t *testing.T) {
+	cases := []struct {
+		original, modified, patch string
+	}{
+		{`{"a": 1}`, `{"a": 1}`, `[]`},
+		{
+			`{"a/b": 1, "m~n": 2}`,
+			`{"a/b": 2}`,
+			`[{"op": "replace", "path": "/a~1b", "value": 2}, {"op": "remove", "path": "/m~0n"}]`,
+		},
+		{
+			`{"a": [1, 2, 3]}`,
+			`{"a": [1], "b": null}`,
+			`[{"op": "remove", "path": "/a/1"}, {"op": "remove", "path": "/a/1"}, {"op": "add", "path": "/b", "value": null}]`,
+		},
+		{
+			`[1, 2, 3, 4]`,
+			`[1, 5, 2, 3, 4]`,
+			`[{"op": "add", "path": "/1", "value": 5}]`,
+		},
+		{
+			`[1, 2, 3, 4]`,
+			`[2, 3, 5, 4, 6]`,
+			`[{"op": "remove", "path": "/0"}, {"op": "add", "path": "/2", "value": 5}, {"op": "add", "path": "/4", "value": 6}]`,
+		},
+		{
+			`[{"a": 1}, {"b": 2}, {"c": 3}]`,
+			`[{"a": 1}, {"b": 3}, {"c": 3}]`,
+			`[{"op": "replace", "path": "/1/b", "value": 3}]`,
+		},
+		{
+			`[{"a": 1, "b": 2}]`,
+			`[{"b": 2, "a": 1}, 1]`,
+			`[{"op": "add", "path": "/1", "value": 1}]`,
+		},
+	}
+
+	for _, c := range cases {
+		patch, err := CreatePatch([]byte(c.original), []byte(c.modified))
+		if err != nil {
+			t.Fatalf("Unable to create patch: %s", err)
+		}
+
+		out, err := json.Marshal(patch)
+		if err != nil {
+			t.Fatalf("Unable to marshal patch: %s", err)
+		}
+
+		if !compareJSON(string(out), c.patch) {
+			t.Errorf("Unexpected patch. Expected:\n%s\n\nActual:\n%s", c.patch, out)
+		}
+	}
+}
+
+func TestCreatePatchWithOptions(t *testing.T) {
+	cases := []struct {
+		original, modified, patch string
+		options                   *DiffOptions
+	}{
+		{
+			`{"a": {"b": [1, 2, 3]}}`,
+			`{"c": {"b": [1, 2, 3]}}`,
+			`[{"op": "move", "from": "/a", "path": "/c"}]`,
+			NewDiffOptions(),
+		},
+		{
+			`{"a": {"b": [1, 2, 3]}}`,
+			`{"c": {"b": [1, 2, 3]}}`,
+			`[{"op": "remove", "path": "/a"}, {"op": "add", "path": "/c", "value": {"b": [1, 2, 3]}}]`,
+			&DiffOptions{},
+		},
+		{
+			`[1, 2, 3]`,
+			`[2, 3, 1]`,
+			`[{"op": "move", "from": "/0", "path": "/2"}]`,
+			NewDiffOptions(),
+		},
+		{
+			`{"a": {"x": [1, 2]}, "b": {}}`,
+			`{"a": {}, "b": {"y": [1, 2]}}`,
+			`[{"op": "move", "from": "/a/x", "path": "/b/y"}]`,
+			NewDiffOptions(),
+		},
+		{
+			`{"a": {"b": [1, 2, 3]}}`,
+			`{"a": {"b": [1, 2, 3]}, "c": {"b": [1, 2, 3]}}`,
+			`[{"op": "copy", "from": "/a", "path": "/c"}]`,
+			&DiffOptions{DetectCopies: true},
+		},
+		{
+			`{"a": {"b": [1, 2, 3]}}`,
+			`{"a": {"b": [1, 2, 3]}, "c": {"b": [1, 2, 3]}}`,
+			`[{"op": "add", "path": "/c", "value": {"b": [1, 2, 3]}}]`,
+			NewDiffOptions(),
+		},
+		{
+			`{"a": {"b": [1, 2, 3]}}`,
+			`{"a": {"b": [1, 2]}, "c": {"b": [1, 2, 3]}}`,
+			`[{"op": "remove", "path": "/a/b/2"}, {"op": "add", "path": "/c", "value": {"b": [1, 2, 3]}}]`,
+			&DiffOptions{DetectCopies: true},
+		},
+		{
+			`{"a_source_path_longer_than_its_value": "abcdefghijklmnop", "s": "abcdefghijklmnop"}`,
+			`{"a_source_path_longer_than_its_value": "abcdefghijklmnop", "s": "abcdefghijklmnop", "c": "abcdefghijklmnop"}`,
+			`[{"op": "copy", "from": "/s", "path": "/c"}]`,
+			&DiffOptions{DetectCopies: true},
+		},
+	}
+
+	for _, c := range cases {
+		patch, err := CreatePatchWithOptions([]byte(c.original), []byte(c.modified), c.options)
+		if err != nil {
+			t.Fatalf("Unable to create patch: %s", err)
+		}
+
+		out, err := json.Marshal(patch)
+		if err != nil {
+			t.Fatalf("Unable to marshal patch: %s", err)
+		}
+
+		if !compareJSON(string(out), c.patch) {
+			t.Errorf("Unexpected patch. Expected:\n%s\n\nActual:\n%s", c.patch, out)
+		}
+	}
+}
+
+func TestCreatePatchLargeArrayInsert(t *testing.T) {
+	original := make([]int, 10000)
+	for i := range original {
+		original[i] = i
+	}
+
+	modified := make([]int, 0, len(original)+1)
+	modified = append(modified, original[:5000]...)
+	modified = append(modified, -1)
+	modified = append(modified, original[5000:]...)
+
+	a, _ := json.Marshal(original)
+	b, _ := json.Marshal(modified)
+
+	patch, err := CreatePatch(a, b)
+	if err != nil {
+		t.Fatalf("Unable to create patch: %s", err)
+	}
+
+	if len(patch) != 1 {
+		t.Fatalf("Expected a single operation, got %d", len(patch))
+	}
+
+	out, err := patch.Apply(a)
+	if err != nil {
+		t.Fatalf("Unable to apply created patch: %s", err)
+	}
+
+	if !Equal(out, b) {
+		t.Errorf("Created patch did not produce the modified document")
+	}
+}
+
+func TestCreatePatchBadJSON(t *testing.T) {
+	if _, err := CreatePatch([]byte(`{"a": 1}`), []byte(`{"a":`)); err != ErrBadJSONDoc {
+		t.Errorf("Expected ErrBadJSONDoc, got %v", err)
+	}
+
+	if _, err := CreatePatch([]byte(``), []byte(`{}`)); err != ErrBadJSONDoc {
+		t.Errorf("Expected ErrBadJSONDoc, got %v", err)
+	}
+}
+
+func TestLookupArrayKeyPrecedence(t *testing.T) {
+	arrayKeys := map[string]string{
+		"/*/containers":    "/name",
+		"/pods/*":          "/uid",
+		"/*/*":             "/id",
+		"/pods/containers": "/image",
+	}
+
+	cases := map[string]string{
+		"/pods/containers": "/image",
+		"/pods/volumes":    "/uid",
+		"/jobs/containers": "/name",
+		"/jobs/volumes":    "/id",
+	}
+
+	// The map is ranged over in a random order, so look up repeatedly.
+	for i := 0; i < 50; i++ {
+		for path, expected := range cases {
+			if key, ok := lookupArrayKey(arrayKeys, path); !ok || key != expected {
+				t.Fatalf("Looking up %s: expected %s, got %s", path, expected, key)
+			}
+		}
+	}
+
+	if _, ok := lookupArrayKey(arrayKeys, "/pods"); ok {
+		t.Errorf("Expected no key for /pods")
+	}
+}
+
+func TestCreatePatchWithArrayKeys(t *testing.T) {
+	cases := []struct {
+		name, original, modified, patch string
+	}{
+		{
+			"change element",
+			`{"containers": [{"name": "a", "image": "x:1"}, {"name": "b", "image": "y:1"}]}`,
+			`{"containers": [{"name": "a", "image": "x:1"}, {"name": "b", "image": "y:2"}]}`,
+			`[{"op": "replace", "path": "/containers/1/image", "value": "y:2"}]`,
+		},
+		{
+			"reorder and change",
+			`{"containers": [{"name": "a", "image": "x:1"}, {"name": "b", "image": "y:1"}]}`,
+			`{"containers": [{"name": "b", "image": "y:2"}, {"name": "a", "image": "x:1"}]}`,
+			`[{"op": "move", "from": "/containers/1", "path": "/containers/0"}, {"op": "replace", "path": "/containers/0/image", "value": "y:2"}]`,
+		},
+		{
+			"add and remove",
+			`{"containers": [{"name": "a"}, {"name": "b"}, {"name": "c"}]}`,
+			`{"containers": [{"name": "d"}, {"name": "c"}, {"name": "a"}]}`,
+			`[{"op": "remove", "path": "/containers/1"}, {"op": "add", "path": "/containers/0", "value": {"name": "d"}}, {"op": "move", "from": "/containers/2", "path": "/containers/1"}]`,
+		},
+		{
+			"nested key",
+			`{"pods": [{"metadata": {"uid": "1"}, "v": 1}, {"metadata": {"uid": "2"}, "v": 2}]}`,
+			`{"pods": [{"metadata": {"uid": "2"}, "v": 2}, {"metadata": {"uid": "1"}, "v": 3}]}`,
+			`[{"op": "move", "from": "/pods/1", "path": "/pods/0"}, {"op": "replace", "path": "/pods/1/v", "value": 3}]`,
+		},
+		{
+			"missing key falls back",
+			`{"containers": [{"name": "a"}, {"image": "x"}]}`,
+			`{"containers": [{"image": "x"}, {"name": "a"}]}`,
+			`[{"op": "move", "from": "/containers/0", "path": "/containers/1"}]`,
+		},
+	}
+
+	options := NewDiffOptions()
+	options.ArrayKeys = map[string]string{
+		"/containers": "/name",
+		"/pods":       "/metadata/uid",
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			patch, err := CreatePatchWithOptions([]byte(c.original), []byte(c.modified), options)
+			if err != nil {
+				t.Fatalf("Unable to create patch: %s", err)
+			}
+
+			out, err := json.Marshal(patch)
+			if err != nil {
+				t.Fatalf("Unable to marshal patch: %s", err)
+			}
+
+			if !compareJSON(string(out), c.patch) {
+				t.Errorf("Unexpected patch. Expected:\n%s\n\nActual:\n%s", c.patch, out)
+			}
+
+			testCreatePatch(t, diffCase{c.name, c.original, c.modified}, options)
+		})
+	}
+}
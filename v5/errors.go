@@ -36,3 +36,43 @@ func NewArraySizeError(l, s int) *ArraySizeError {
 func (a *ArraySizeError) Error() string {
 	return fmt.Sprintf("Unable to create array of size %d, limit is %d", a.size, a.limit)
 }
+
+// PatchError is the error type returned when an operation of a patch fails
+// to apply. It matches the error that caused it with errors.Is and errors.As.
+type PatchError struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	// Op is the kind of the operation, such as "add".
+	Op string
+	// Path is the "path" of the operation, as found in the patch.
+	Path string
+	// From is the "from" of "move" and "copy" operations.
+	From string
+	// Cause is the error the operation failed with.
+	Cause error
+}
+
+// NewPatchError returns a PatchError for the operation at index in a patch.
+func NewPatchError(index int, op Operation, cause error) *PatchError {
+	e := &PatchError{Index: index, Op: op.Kind(), Cause: cause}
+
+	if path, err := op.Path(); err == nil {
+		e.Path = path
+	}
+
+	if from, err := op.From(); err == nil {
+		e.From = from
+	}
+
+	return e
+}
+
+// Error implements the error interface. The message is the one of Cause.
+func (e *PatchError) Error() string {
+	return e.Cause.Error()
+}
+
+// Unwrap returns the cause of the error.
+func (e *PatchError) Unwrap() error {
+	return e.Cause
+}
@@ -0,0 +1,251 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expand returns the patch with every operation whose "path" is a JSONPath
+// expression, such as "$.items[?@.enabled==false].replicas", replaced by one
+// operation per location the expression matches. See ExpandWithOptions.
+func (p Patch) Expand(doc []byte) (Patch, error) {
+	return p.ExpandWithOptions(doc, NewApplyOptions())
+}
+
+// ExpandWithOptions returns the patch with every operation whose "path" starts
+// with "$" replaced by the operations it expands to, whether or not
+// options.AllowJSONPath is set. So are the operations whose path holds a "*"
+// segment if options.AllowWildcards is set. Each operation is expanded against
+// the document as changed by the operations before it, so the returned patch
+// applied to doc gives the same result as p applied with AllowJSONPath.
+//
+// An expression matching nothing expands to no operation at all, unless
+// options.RequireMatch is set. For "add", "copy" and "move", a JSONPath
+// expression ending with a member name, such as "$.items[*].replicas", targets
+// that member of every object the rest of the expression matches, whether or
+// not it exists yet. The operations an expression expands to are ordered from
+// the last match in the document to the first, which keeps the array indices
+// of the remaining ones valid.
+func (p Patch) ExpandWithOptions(doc []byte, options *ApplyOptions) (Patch, error) {
+	opts := *options.effective()
+	opts.AllowJSONPath = true
+
+	pd, err := newContainer(doc, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var accumulatedCopySize int64
+	expanded := Patch{}
+
+	for i, op := range p {
+		ops := Patch{op}
+		if isExpandedOperation(op, &opts) {
+			if ops, err = expandOperation(pd, op, &opts); err != nil {
+				return nil, NewPatchError(i, op, err)
+			}
+		}
+
+		for _, concrete := range ops {
+			if err := p.applyOperation(&pd, concrete, &accumulatedCopySize, &opts); err != nil {
+				return nil, NewPatchError(i, op, err)
+			}
+		}
+
+		expanded = append(expanded, ops...)
+	}
+
+	return expanded, nil
+}
+
+// isExpandedOperation reports whether the path of op may match several
+// locations, as a JSONPath expression or a path with wildcards.
+func isExpandedOperation(op Operation, options *ApplyOptions) bool {
+	return isJSONPathOperation(op, options) || isWildcardOperation(op, options)
+}
+
+// isJSONPathOperation reports whether the path of op is to be read as a
+// JSONPath expression.
+func isJSONPathOperation(op Operation, options *ApplyOptions) bool {
+	if !options.AllowJSONPath {
+		return false
+	}
+
+	path, err := op.Path()
+	return err == nil && strings.HasPrefix(path, "$")
+}
+
+// isWildcardOperation reports whether the path of op holds a "*" segment to
+// be read as a wildcard.
+func isWildcardOperation(op Operation, options *ApplyOptions) bool {
+	if !options.AllowWildcards {
+		return false
+	}
+
+	path, err := op.Path()
+	if err != nil || strings.HasPrefix(path, "$") && options.AllowJSONPath {
+		return false
+	}
+
+	for _, part := range strings.Split(path, "/") {
+		if part == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandOperation returns one copy of op per location its path matches in
+// doc, with the "path" of each set to the JSON Pointer of the location.
+func expandOperation(doc container, op Operation, options *ApplyOptions) (Patch, error) {
+	var ops Patch
+	var err error
+
+	if isJSONPathOperation(op, options) {
+		ops, err = expandJSONPath(doc, op, options)
+	} else {
+		ops, err = expandWildcards(doc, op, options)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 && options.RequireMatch {
+		path, _ := op.Path()
+		return nil, fmt.Errorf("path %s does not match any location: %w", path, ErrMissing)
+	}
+
+	return ops, nil
+}
+
+// applyExpanded applies an operation whose path may match several locations.
+// If the operation fails at one of them, the document is restored to its
+// state before the first one.
+func (p Patch) applyExpanded(pd *container, op Operation, accumulatedCopySize *int64, options *ApplyOptions) error {
+	ops, err := expandOperation(*pd, op, options)
+	if err != nil {
+		return err
+	}
+
+	if len(ops) == 1 {
+		return p.applyOperation(pd, ops[0], accumulatedCopySize, options)
+	}
+
+	snapshot, err := marshalContainer(*pd, "", options)
+	if err != nil {
+		return err
+	}
+	copySize := *accumulatedCopySize
+
+	for _, concrete := range ops {
+		if err := p.applyOperation(pd, concrete, accumulatedCopySize, options); err != nil {
+			if restored, rerr := newContainer(snapshot, options); rerr == nil {
+				*pd = restored
+				*accumulatedCopySize = copySize
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandWildcards returns one copy of op per location its path matches in
+// doc, where a "*" segment matches every member of an object or element of an
+// array. Like findObject, it only requires the parent of each location to
+// exist, and the operation fails at locations that lack the last segment.
+func expandWildcards(doc container, op Operation, options *ApplyOptions) (Patch, error) {
+	path, err := op.Path()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("path %s does not start with '/': %w", path, ErrInvalid)
+	}
+
+	var paths []string
+	findWildcardPaths(doc, "", parts[1:], options, &paths)
+
+	ops := make(Patch, 0, len(paths))
+
+	// From the last location to the first, so that removing or inserting
+	// array elements does not shift the ones left to apply to.
+	for i := len(paths) - 1; i >= 0; i-- {
+		concrete := make(Operation, len(op))
+		for k, v := range op {
+			concrete[k] = v
+		}
+		concrete["path"] = rawString(paths[i])
+
+		ops = append(ops, concrete)
+	}
+
+	return ops, nil
+}
+
+// findWildcardPaths appends to paths the location of every value of doc that
+// the encoded reference tokens in parts match, prefixed with prefix.
+func findWildcardPaths(doc container, prefix string, parts []string, options *ApplyOptions, paths *[]string) {
+	part := parts[0]
+
+	keys := []string{part}
+	if part == "*" {
+		keys = containerKeys(doc)
+	}
+
+	if len(parts) == 1 {
+		for _, key := range keys {
+			*paths = append(*paths, prefix+"/"+key)
+		}
+		return
+	}
+
+	for _, key := range keys {
+		next, err := doc.get(decodePatchKey(key), options)
+		if err != nil {
+			continue
+		}
+
+		var child container
+
+		switch nodeKind(next) {
+		case kindObject:
+			child, err = next.intoDoc(options)
+		case kindArray:
+			child, err = next.intoAry()
+		default:
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		findWildcardPaths(child, prefix+"/"+key, parts[1:], options, paths)
+	}
+}
+
+// containerKeys returns the encoded reference tokens of the members or
+// elements of doc, in order.
+func containerKeys(doc container) []string {
+	var keys []string
+
+	switch d := doc.(type) {
+	case *partialDoc:
+		for _, k := range d.keys {
+			keys = append(keys, encodePatchKey(k))
+		}
+	case *partialArray:
+		for i := range d.nodes {
+			keys = append(keys, strconv.Itoa(i))
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,151 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var containersDoc = `{"spec": {"containers": [{"name": "a", "image": "a:1"}, {"name": "b", "image": "b:1"}]}}`
+
+func TestWildcardPatch(t *testing.T) {
+	cases := []struct {
+		doc, patch, result string
+	}{
+		{
+			containersDoc,
+			`[{"op": "replace", "path": "/spec/containers/*/image", "value": "c:2"}]`,
+			`{"spec": {"containers": [{"name": "a", "image": "c:2"}, {"name": "b", "image": "c:2"}]}}`,
+		},
+		{
+			containersDoc,
+			`[{"op": "add", "path": "/spec/containers/*/pull", "value": "always"}]`,
+			`{"spec": {"containers": [{"name": "a", "image": "a:1", "pull": "always"}, {"name": "b", "image": "b:1", "pull": "always"}]}}`,
+		},
+		{
+			containersDoc,
+			`[{"op": "remove", "path": "/spec/containers/*"}]`,
+			`{"spec": {"containers": []}}`,
+		},
+		{
+			`{"a": {"x": {"v": 1}, "y": {"v": 2}, "z": 3}}`,
+			`[{"op": "remove", "path": "/a/*/v"}]`,
+			`{"a": {"x": {}, "y": {}, "z": 3}}`,
+		},
+		{
+			`{"a": [[1], [1, 3]]}`,
+			`[{"op": "add", "path": "/a/*/-", "value": 0}, {"op": "test", "path": "/a/*/0", "value": 1}]`,
+			`{"a": [[1, 0], [1, 3, 0]]}`,
+		},
+		{
+			`{"a": [[1], [2, 3]]}`,
+			`[{"op": "test", "path": "/a/*/0", "value": 1}]`,
+			``,
+		},
+		{
+			`{"a": {}, "b": {"c": 1}}`,
+			`[{"op": "remove", "path": "/a/*/x"}, {"op": "copy", "from": "/b/c", "path": "/*/d"}]`,
+			`{"a": {"d": 1}, "b": {"c": 1, "d": 1}}`,
+		},
+	}
+
+	options := NewApplyOptions()
+	options.AllowWildcards = true
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		out, err := p.ApplyWithOptions([]byte(c.doc), options)
+		if c.result == "" {
+			if !errors.Is(err, ErrTestFailed) {
+				t.Errorf("Applying %s: expected ErrTestFailed, got %v", c.patch, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unable to apply %s: %s", c.patch, err)
+			continue
+		}
+
+		if !compareJSON(string(out), c.result) {
+			t.Errorf("Applying %s: expected %s, got %s", c.patch, reformatJSON(c.result), reformatJSON(string(out)))
+		}
+
+		expanded, err := p.ExpandWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to expand %s: %s", c.patch, err)
+			continue
+		}
+
+		if out, err := expanded.Apply([]byte(c.doc)); err != nil || !compareJSON(string(out), c.result) {
+			t.Errorf("Applying the expansion of %s gave %s: %v", c.patch, out, err)
+		}
+	}
+}
+
+func TestWildcardExpansion(t *testing.T) {
+	p, err := DecodePatch([]byte(`[{"op": "replace", "path": "/spec/containers/*/image", "value": "c:2"}]`))
+	if err != nil {
+		t.Fatalf("Unable to decode patch: %s", err)
+	}
+
+	options := NewApplyOptions()
+	options.AllowWildcards = true
+
+	expanded, err := p.ExpandWithOptions([]byte(containersDoc), options)
+	if err != nil {
+		t.Fatalf("Unable to expand: %s", err)
+	}
+
+	var paths []string
+	for _, op := range expanded {
+		path, _ := op.Path()
+		paths = append(paths, path)
+	}
+
+	expected := []string{"/spec/containers/1/image", "/spec/containers/0/image"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %q, got %q", expected, paths)
+	}
+
+	// Without AllowWildcards, "*" is a member name like any other.
+	if _, err := p.Apply([]byte(containersDoc)); err == nil {
+		t.Errorf("Expected a wildcard to be rejected by default")
+	}
+}
+
+func TestWildcardRequireMatch(t *testing.T) {
+	cases := []string{
+		`[{"op": "remove", "path": "/spec/missing/*"}]`,
+		`[{"op": "remove", "path": "/spec/containers/*/x/y"}]`,
+		`[{"op": "replace", "path": "$.spec.containers[?@.name == 'c'].image", "value": 1}]`,
+	}
+
+	options := NewApplyOptions()
+	options.AllowWildcards = true
+	options.AllowJSONPath = true
+
+	for _, patch := range cases {
+		p, err := DecodePatch([]byte(patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", patch, err)
+		}
+
+		options.RequireMatch = false
+
+		out, err := p.ApplyWithOptions([]byte(containersDoc), options)
+		if err != nil || !compareJSON(string(out), containersDoc) {
+			t.Errorf("Expected %s to do nothing, got %s: %v", patch, out, err)
+		}
+
+		options.RequireMatch = true
+
+		if _, err := p.ApplyWithOptions([]byte(containersDoc), options); !errors.Is(err, ErrMissing) {
+			t.Errorf("Applying %s: expected ErrMissing, got %v", patch, err)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// ErrWrongType is returned by the extension operations when a value is not of
+// the type the operation works on.
+var ErrWrongType = errors.New("invalid value, wrong type")
+
+// RegisterExtensionOperations registers the following non-standard operations
+// on the options, each applying to the value at its "path":
+//
+//   - "increment" and "decrement" add or subtract the number in "value",
+//     which defaults to 1.
+//   - "min" and "max" keep the smallest or largest of the value and the
+//     number in "value".
+//   - "append" appends the string in "value" to the string.
+//   - "toggle" negates the boolean.
+//
+// Numbers are handled as decimal json.Number values rather than float64, so
+// that large integers and decimal fractions are not rounded.
+func (o *ApplyOptions) RegisterExtensionOperations() {
+	o.RegisterOperation("increment", arithmeticHandler(func(a, b decimal) (decimal, error) { return a.sum(b) }, true))
+	o.RegisterOperation("decrement", arithmeticHandler(func(a, b decimal) (decimal, error) { return a.sum(b.neg()) }, true))
+	o.RegisterOperation("min", arithmeticHandler(func(a, b decimal) (decimal, error) { return a.min(b), nil }, false))
+	o.RegisterOperation("max", arithmeticHandler(func(a, b decimal) (decimal, error) { return a.max(b), nil }, false))
+	o.RegisterOperation("append", appendHandler)
+	o.RegisterOperation("toggle", toggleHandler)
+}
+
+// arithmeticHandler returns a handler storing f applied to the number at the
+// target and the number in the "value" of the operation. If optional, the
+// value defaults to 1.
+func arithmeticHandler(f func(a, b decimal) (decimal, error), optional bool) OperationHandler {
+	return func(op Operation, target *OperationTarget) error {
+		buf, err := target.Get()
+		if err != nil {
+			return err
+		}
+
+		a, err := decodeDecimal(buf)
+		if err != nil {
+			return fmt.Errorf("value at path: %w", err)
+		}
+
+		b := decimal{mant: big.NewInt(1)}
+
+		switch raw, ok := op["value"]; {
+		case !ok && optional:
+		case !ok:
+			return fmt.Errorf("operation requires a number value: %w", ErrMissing)
+		case raw == nil:
+			return fmt.Errorf("operation value is not a number: %w", ErrWrongType)
+		default:
+			if b, err = decodeDecimal(*raw); err != nil {
+				return fmt.Errorf("operation value: %w", err)
+			}
+		}
+
+		result, err := f(a, b)
+		if err != nil {
+			return err
+		}
+
+		return target.Set([]byte(result.String()))
+	}
+}
+
+func appendHandler(op Operation, target *OperationTarget) error {
+	buf, err := target.Get()
+	if err != nil {
+		return err
+	}
+
+	var s, suffix string
+
+	if len(buf) == 0 || buf[0] != '"' || json.Unmarshal(buf, &s) != nil {
+		return fmt.Errorf("value at path is not a string: %w", ErrWrongType)
+	}
+
+	raw, ok := op["value"]
+	if !ok {
+		return fmt.Errorf("operation requires a string value: %w", ErrMissing)
+	}
+
+	if raw == nil || json.Unmarshal(*raw, &suffix) != nil {
+		return fmt.Errorf("operation value is not a string: %w", ErrWrongType)
+	}
+
+	out, err := json.MarshalEscaped(s+suffix, target.options.EscapeHTML)
+	if err != nil {
+		return err
+	}
+
+	return target.Set(out)
+}
+
+func toggleHandler(op Operation, target *OperationTarget) error {
+	buf, err := target.Get()
+	if err != nil {
+		return err
+	}
+
+	switch string(buf) {
+	case "true":
+		return target.Set([]byte("false"))
+	case "false":
+		return target.Set([]byte("true"))
+	}
+
+	return fmt.Errorf("value at path is not a boolean: %w", ErrWrongType)
+}
+
+// maxDecimalShift bounds the difference between the exponents of the numbers
+// an operation adds.
+const maxDecimalShift = 10000
+
+// decimal is the number mant×10^exp.
+type decimal struct {
+	mant *big.Int
+	exp  int
+}
+
+// decodeDecimal decodes a JSON number.
+func decodeDecimal(buf []byte) (decimal, error) {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return decimal{}, err
+	}
+
+	n, ok := v.(json.Number)
+	if !ok {
+		return decimal{}, fmt.Errorf("%s is not a number: %w", buf, ErrWrongType)
+	}
+
+	s := n.String()
+	exp := 0
+
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || e > 1<<30 || e < -(1<<30) {
+			return decimal{}, fmt.Errorf("exponent of %s out of range: %w", s, ErrInvalid)
+		}
+
+		s, exp = s[:i], e
+	}
+
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		exp -= len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+
+	mant, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return decimal{}, fmt.Errorf("%s is not a number: %w", n, ErrWrongType)
+	}
+
+	return decimal{mant: mant, exp: exp}, nil
+}
+
+// aligned returns the mantissas of d and o scaled to their smallest exponent.
+func (d decimal) aligned(o decimal) (*big.Int, *big.Int, int) {
+	exp := d.exp
+	if o.exp < exp {
+		exp = o.exp
+	}
+
+	scale := func(x decimal) *big.Int {
+		pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(x.exp-exp)), nil)
+		return pow.Mul(pow, x.mant)
+	}
+
+	return scale(d), scale(o), exp
+}
+
+func (d decimal) add(o decimal) decimal {
+	a, b, exp := d.aligned(o)
+	return decimal{mant: a.Add(a, b), exp: exp}
+}
+
+// sum returns d+o. Both numbers are written out in full to be added, which
+// only takes a reasonable amount of memory if their exponents are close.
+func (d decimal) sum(o decimal) (decimal, error) {
+	if diff := d.exp - o.exp; diff > maxDecimalShift || diff < -maxDecimalShift {
+		return decimal{}, fmt.Errorf("numbers %s and %s are too far apart: %w", d, o, ErrInvalid)
+	}
+
+	return d.add(o), nil
+}
+
+func (d decimal) neg() decimal {
+	return decimal{mant: new(big.Int).Neg(d.mant), exp: d.exp}
+}
+
+func (d decimal) cmp(o decimal) int {
+	ds, os := d.mant.Sign(), o.mant.Sign()
+	if ds != os || ds == 0 {
+		return ds - os
+	}
+
+	// Numbers of different magnitudes compare without being aligned, which
+	// bounds the work to the length of their digits.
+	if dm, om := d.magnitude(), o.magnitude(); dm != om {
+		if dm > om {
+			return ds
+		}
+		return -ds
+	}
+
+	a, b, _ := d.aligned(o)
+	return a.Cmp(b)
+}
+
+// magnitude returns the exponent of the leading digit of d plus one.
+func (d decimal) magnitude() int {
+	return d.exp + len(new(big.Int).Abs(d.mant).String())
+}
+
+// isInteger reports whether d has no fractional part.
+func (d decimal) isInteger() bool {
+	if d.exp >= 0 || d.mant.Sign() == 0 {
+		return true
+	}
+
+	if d.magnitude() <= 0 {
+		return false
+	}
+
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-d.exp)), nil)
+	return new(big.Int).Rem(d.mant, pow).Sign() == 0
+}
+
+func (d decimal) min(o decimal) decimal {
+	if o.cmp(d) < 0 {
+		return o
+	}
+
+	return d
+}
+
+func (d decimal) max(o decimal) decimal {
+	if o.cmp(d) > 0 {
+		return o
+	}
+
+	return d
+}
+
+// String returns d as a JSON number, without trailing zeros in its fraction.
+func (d decimal) String() string {
+	mant, exp := new(big.Int).Set(d.mant), d.exp
+
+	ten := big.NewInt(10)
+	for exp < 0 && mant.Sign() != 0 {
+		q, r := new(big.Int).QuoRem(mant, ten, new(big.Int))
+		if r.Sign() != 0 {
+			break
+		}
+		mant, exp = q, exp+1
+	}
+
+	if mant.Sign() == 0 {
+		return "0"
+	}
+
+	sign := ""
+	if mant.Sign() < 0 {
+		sign = "-"
+	}
+
+	digits := new(big.Int).Abs(mant).String()
+
+	switch {
+	case exp == 0:
+		return sign + digits
+	case exp > 0 && exp <= 20:
+		return sign + digits + strings.Repeat("0", exp)
+	case exp > 0:
+		return sign + digits + "e" + strconv.Itoa(exp)
+	}
+
+	// Like large exponents, small ones are written as such rather than as
+	// a long run of zeros.
+	if point := len(digits) + exp; point < -20 {
+		frac := ""
+		if len(digits) > 1 {
+			frac = "." + digits[1:]
+		}
+		return sign + digits[:1] + frac + "e" + strconv.Itoa(point-1)
+	}
+
+	if pad := -exp - len(digits) + 1; pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+
+	point := len(digits) + exp
+	return sign + digits[:point] + "." + digits[point:]
+}
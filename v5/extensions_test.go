@@ -0,0 +1,116 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExtensionOperations(t *testing.T) {
+	cases := []struct {
+		doc, patch, result string
+	}{
+		{`{"a": 1}`, `[{"op": "increment", "path": "/a"}]`, `{"a":2}`},
+		{`{"a": 1}`, `[{"op": "increment", "path": "/a", "value": -3}]`, `{"a":-2}`},
+		{`{"a": 9007199254740993}`, `[{"op": "increment", "path": "/a"}]`, `{"a":9007199254740994}`},
+		{`{"a": 123456789012345678901234567890}`, `[{"op": "decrement", "path": "/a", "value": 1}]`, `{"a":123456789012345678901234567889}`},
+		{`{"a": 0.1}`, `[{"op": "increment", "path": "/a", "value": 0.2}]`, `{"a":0.3}`},
+		{`{"a": 1.25}`, `[{"op": "decrement", "path": "/a", "value": 1.5}]`, `{"a":-0.25}`},
+		{`{"a": 1e3}`, `[{"op": "increment", "path": "/a", "value": 2.5E-1}]`, `{"a":1000.25}`},
+		{`{"a": 0.5}`, `[{"op": "decrement", "path": "/a", "value": 0.5}]`, `{"a":0}`},
+		{`{"a": [5, 1]}`, `[{"op": "min", "path": "/a/0", "value": 3}, {"op": "min", "path": "/a/1", "value": 3}]`, `{"a":[3,1]}`},
+		{`{"a": [5, 1]}`, `[{"op": "max", "path": "/a/0", "value": 3}, {"op": "max", "path": "/a/1", "value": 3}]`, `{"a":[5,3]}`},
+		{`{"a": "foo"}`, `[{"op": "append", "path": "/a", "value": "bar"}]`, `{"a":"foobar"}`},
+		{`{"a": "é"}`, `[{"op": "append", "path": "/a", "value": "<è>"}]`, `{"a":"é\u003cè\u003e"}`},
+		{`{"a": true, "b": false}`, `[{"op": "toggle", "path": "/a"}, {"op": "toggle", "path": "/b"}]`, `{"a":false,"b":true}`},
+		{`[{"a": [1]}]`, `[{"op": "increment", "path": "/0/a/-1", "value": 1.5}]`, `[{"a":[2.5]}]`},
+		{`{"a": 1e-99999999}`, `[{"op": "max", "path": "/a", "value": 2e-99999999}]`, `{"a":2e-99999999}`},
+		{`{"a": [1e-20000, 1e-20000]}`, `[{"op": "max", "path": "/a/0", "value": 1}, {"op": "min", "path": "/a/1", "value": 1}]`, `{"a":[1,1e-20000]}`},
+	}
+
+	options := NewApplyOptions()
+	options.RegisterExtensionOperations()
+
+	for _, c := range cases {
+		p, err := DecodePatchWithOptions([]byte(c.patch), options)
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		out, err := p.ApplyWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to apply %s: %s", c.patch, err)
+			continue
+		}
+
+		// The result is compared as is, as comparing decoded documents would
+		// round the numbers.
+		if string(out) != c.result {
+			t.Errorf("Applying %s: expected %s, got %s", c.patch, c.result, out)
+		}
+	}
+}
+
+func TestExtensionOperationErrors(t *testing.T) {
+	cases := []struct {
+		patch string
+		err   error
+	}{
+		{`[{"op": "increment", "path": "/s"}]`, ErrWrongType},
+		{`[{"op": "increment", "path": "/n", "value": "1"}]`, ErrWrongType},
+		{`[{"op": "increment", "path": "/n", "value": null}]`, ErrWrongType},
+		{`[{"op": "increment", "path": "/x"}]`, ErrMissing},
+		{`[{"op": "min", "path": "/n"}]`, ErrMissing},
+		{`[{"op": "max", "path": "/b", "value": 1}]`, ErrWrongType},
+		{`[{"op": "append", "path": "/n", "value": "a"}]`, ErrWrongType},
+		{`[{"op": "append", "path": "/s", "value": 1}]`, ErrWrongType},
+		{`[{"op": "append", "path": "/s"}]`, ErrMissing},
+		{`[{"op": "toggle", "path": "/s"}]`, ErrWrongType},
+		{`[{"op": "increment", "path": "/n", "value": 1e100000}]`, ErrInvalid},
+		{`[{"op": "decrement", "path": "/n", "value": 1e-100000}]`, ErrInvalid},
+	}
+
+	options := NewApplyOptions()
+	options.RegisterExtensionOperations()
+
+	for _, c := range cases {
+		p, err := DecodePatchWithOptions([]byte(c.patch), options)
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		if _, err := p.ApplyWithOptions([]byte(`{"n": 1, "s": "a", "b": true}`), options); !errors.Is(err, c.err) {
+			t.Errorf("Applying %s: expected %v, got %v", c.patch, c.err, err)
+		}
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	cases := map[string]string{
+		"0":       "0",
+		"-0":      "0",
+		"10":      "10",
+		"1.50":    "1.5",
+		"-0.001":  "-0.001",
+		"1e2":     "100",
+		"12e-1":   "1.2",
+		"1E25":    "1e25",
+		"100e-2":  "1",
+		"0.0e+10": "0",
+		"1e-21":   "0.000000000000000000001",
+		"1e-22":   "1e-22",
+		"-2e-30":  "-2e-30",
+		"5e-999":  "5e-999",
+	}
+
+	for in, expected := range cases {
+		d, err := decodeDecimal([]byte(in))
+		if err != nil {
+			t.Errorf("Unable to decode %s: %s", in, err)
+			continue
+		}
+
+		if d.String() != expected {
+			t.Errorf("Expected %s to be written as %s, got %s", in, expected, d)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func FuzzDecodePatchApply(f *testing.F) {
+	f.Add([]byte(`{"foo": "bar", "a": [1, 2, {"b": null}]}`), []byte(`[{"op": "add", "path": "/baz", "value": "qux"}]`))
+	f.Add([]byte(`{"foo": ["bar", "baz"]}`), []byte(`[{"op": "add", "path": "/foo/-1", "value": "qux"}]`))
+	f.Add([]byte(`{"foo": {"bar": 1}}`), []byte(`[{"op": "move", "from": "/foo/bar", "path": "/bar"}]`))
+	f.Add([]byte(`[1, 2, 3]`), []byte(`[{"op": "copy", "from": "/0", "path": "/-"}, {"op": "remove", "path": "/1"}]`))
+	f.Add([]byte(`{"a": null}`), []byte(`[{"op": "test", "path": "/a", "value": null}, {"op": "replace", "path": "", "value": []}]`))
+	f.Add([]byte(`{"": {"": ""}}`), []byte(`[{"op": "test", "path": "/", "value": {"": ""}}]`))
+	f.Add([]byte(`{"": {}}`), []byte(`[{"op": "test", "path": ""}]`))
+	f.Add([]byte(`[null, [null]]`), []byte(`[{"op": "test", "path": "/1", "value": [null]}]`))
+
+	f.Fuzz(func(t *testing.T, doc, patch []byte) {
+		p, err := DecodePatch(patch)
+		if err != nil {
+			return
+		}
+
+		out, err := p.Apply(doc)
+		if err != nil {
+			return
+		}
+
+		if len(doc) > 0 && !json.Valid(out) {
+			t.Fatalf("Applying %s to %s gave invalid JSON %s", patch, doc, out)
+		}
+
+		indented, err := p.ApplyIndent(doc, "  ")
+		if err != nil {
+			t.Fatalf("Applying %s indented failed after applying: %s", patch, err)
+		}
+
+		if !compareJSON(string(out), string(indented)) {
+			t.Fatalf("Applying %s indented gave %s, expected %s", patch, indented, out)
+		}
+	})
+}
+
+func FuzzMergePatch(f *testing.F) {
+	f.Add([]byte(`{"a": "b"}`), []byte(`{"a": "c"}`))
+	f.Add([]byte(`{"a": {"b": "c"}}`), []byte(`{"a": {"b": null, "d": [1]}}`))
+	f.Add([]byte(`{"a": [{"b": "c"}]}`), []byte(`{"a": [1]}`))
+	f.Add([]byte(`{"a": 1}`), []byte(`["c"]`))
+	f.Add([]byte(`{}`), []byte(`{"a": {"bb": {"ccc": null}}}`))
+
+	f.Fuzz(func(t *testing.T, doc, patch []byte) {
+		out, err := MergePatch(doc, patch)
+		if err != nil {
+			return
+		}
+
+		if !json.Valid(out) {
+			t.Fatalf("Merging %s into %s gave invalid JSON %s", patch, doc, out)
+		}
+
+		// Applying a merge patch is idempotent.
+		again, err := MergePatch(out, patch)
+		if err != nil {
+			if isJSONObject(out) {
+				t.Fatalf("Merging %s into %s again failed: %s", patch, out, err)
+			}
+			return
+		}
+
+		if !compareJSON(string(out), string(again)) {
+			t.Fatalf("Merging %s into %s twice gave %s, then %s", patch, doc, out, again)
+		}
+	})
+}
+
+func FuzzMergeMergePatches(f *testing.F) {
+	f.Add([]byte(`{"a": 1, "b": {"c": 2}}`), []byte(`{"a": null}`), []byte(`{"b": {"d": 3}}`))
+	f.Add([]byte(`{"a": {"b": 1}}`), []byte(`{"a": {"b": null}}`), []byte(`{"a": {"b": 2}}`))
+	f.Add([]byte(`{}`), []byte(`{"a": [1]}`), []byte(`{"a": {"b": null}}`))
+	f.Add([]byte(`{"a": {"c": 1}}`), []byte(`{"a": null}`), []byte(`{"a": {"b": 1}}`))
+
+	f.Fuzz(func(t *testing.T, doc, patch1, patch2 []byte) {
+		var p1, p2 map[string]interface{}
+		if !isJSONObject(doc) || json.Unmarshal(patch1, &p1) != nil || json.Unmarshal(patch2, &p2) != nil || p1 == nil || p2 == nil {
+			return
+		}
+
+		// A merge patch cannot replace an object as a whole, so no single
+		// one does what patch1 then patch2 do when patch2 sets an object
+		// where patch1 set something else.
+		if replacesWithObject(p1, p2) {
+			return
+		}
+
+		first, err := MergePatch(doc, patch1)
+		if err != nil {
+			return
+		}
+
+		sequential, err := MergePatch(first, patch2)
+		if err != nil {
+			return
+		}
+
+		merged, err := MergeMergePatches(patch1, patch2)
+		if err != nil {
+			t.Fatalf("Unable to merge %s and %s: %s", patch1, patch2, err)
+		}
+
+		combined, err := MergePatch(doc, merged)
+		if err != nil {
+			t.Fatalf("Unable to merge %s into %s: %s", merged, doc, err)
+		}
+
+		if !compareJSON(string(sequential), string(combined)) {
+			t.Fatalf("Merging %s then %s into %s gave %s, but their merge %s gave %s", patch1, patch2, doc, sequential, merged, combined)
+		}
+	})
+}
+
+func FuzzCreateMergePatch(f *testing.F) {
+	f.Add([]byte(`{"a": "b", "c": {"d": "e"}}`), []byte(`{"a": "b", "c": {"d": "f", "g": [1]}}`))
+	f.Add([]byte(`{"a": 1, "b": 2}`), []byte(`{"a": 1}`))
+	f.Add([]byte(`{"a": [1, 2]}`), []byte(`{"a": {"b": 1}}`))
+	f.Add([]byte(`[1, 2]`), []byte(`[1, 2, 3]`))
+	f.Add([]byte(`{"a": {"b": 1}}`), []byte(`{"a": {"b": null}}`))
+	f.Add([]byte(`[{"a": 1, "b": 1}]`), []byte(`[{"a": 1}]`))
+	f.Add([]byte(`null`), []byte(`{"a": 1}`))
+	f.Add([]byte(`{"a": 1}`), []byte(`null`))
+	f.Add([]byte(`A`), []byte(`0`))
+
+	f.Fuzz(func(t *testing.T, original, modified []byte) {
+		patch, err := CreateMergePatch(original, modified)
+		if err != nil {
+			return
+		}
+
+		if !json.Valid(patch) {
+			t.Fatalf("Diffing %s and %s gave invalid JSON %s", original, modified, patch)
+		}
+
+		// Arrays of documents are diffed into an array of merge patches, one
+		// per document.
+		originals := []json.RawMessage{original}
+		modifieds := []json.RawMessage{modified}
+		patches := []json.RawMessage{patch}
+
+		if resemblesJSONArray(original) {
+			// Decoding into fresh slices keeps the fuzz inputs, which the
+			// slices above hold, from being overwritten.
+			var xs, ys, ps []json.RawMessage
+			if err := json.Unmarshal(original, &xs); err != nil {
+				t.Fatalf("Unable to decode %s: %s", original, err)
+			}
+			if err := json.Unmarshal(modified, &ys); err != nil {
+				t.Fatalf("Unable to decode %s: %s", modified, err)
+			}
+			if err := json.Unmarshal(patch, &ps); err != nil {
+				t.Fatalf("Unable to decode %s: %s", patch, err)
+			}
+
+			if len(xs) != len(ps) || len(ys) != len(ps) {
+				t.Fatalf("Diffing %s and %s gave %s, which does not hold a patch per document", original, modified, patch)
+			}
+
+			originals, modifieds, patches = xs, ys, ps
+		}
+
+		for i := range patches {
+			// A merge patch cannot set a member to null, as that removes it.
+			if hasNullMember(modifieds[i]) {
+				continue
+			}
+
+			// MergePatch does not accept null as the document to patch.
+			if isNull(originals[i]) {
+				continue
+			}
+
+			out, err := MergePatch(originals[i], patches[i])
+			if err != nil {
+				t.Fatalf("Unable to merge %s into %s: %s", patches[i], originals[i], err)
+			}
+
+			if !compareJSON(string(out), string(modifieds[i])) {
+				t.Fatalf("Merging %s into %s gave %s, expected %s", patches[i], originals[i], out, modifieds[i])
+			}
+		}
+	})
+}
+
+// isNull reports whether buf holds the JSON value null.
+func isNull(buf []byte) bool {
+	var v interface{}
+	return json.Unmarshal(buf, &v) == nil && v == nil
+}
+
+// hasNullMember reports whether the JSON object in buf, or an object among its
+// members, has a member that is null.
+func hasNullMember(buf []byte) bool {
+	var obj map[string]interface{}
+	if json.Unmarshal(buf, &obj) != nil {
+		return false
+	}
+
+	var walk func(obj map[string]interface{}) bool
+	walk = func(obj map[string]interface{}) bool {
+		for _, v := range obj {
+			if v == nil {
+				return true
+			}
+
+			if o, ok := v.(map[string]interface{}); ok && walk(o) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return walk(obj)
+}
+
+// replacesWithObject reports whether merge patch p2 holds an object where p1
+// holds a value that is not one.
+func replacesWithObject(p1, p2 map[string]interface{}) bool {
+	for k, v2 := range p2 {
+		o2, ok := v2.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		v1, ok := p1[k]
+		if !ok {
+			continue
+		}
+
+		o1, ok := v1.(map[string]interface{})
+		if !ok || replacesWithObject(o1, o2) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isJSONObject reports whether buf holds a single JSON object.
+func isJSONObject(buf []byte) bool {
+	var v map[string]interface{}
+	return json.Unmarshal(buf, &v) == nil && v != nil
+}
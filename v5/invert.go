@@ -0,0 +1,411 @@
+package jsonpatch
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// opEffect records what a single operation did to a document, with every
+// array index in its paths made absolute.
+type opEffect struct {
+	kind string
+	path string
+	from string
+	// previous holds the value at path before the operation, or nil if
+	// there was none. Inserting into an array never has a previous value.
+	// For a "move", it is the value at path once from was removed.
+	previous []byte
+	// moved holds the value a "move" took from from.
+	moved []byte
+	// ancestor is the deepest parent of path that existed before an "add"
+	// created the missing parts of path, and ancestorPrevious its value.
+	ancestor         string
+	ancestorPrevious []byte
+	// custom is set for operations of a kind registered in the options,
+	// and exists tells whether path held a value after one of them.
+	custom bool
+	exists bool
+	// arrayLen is the length of the array holding path before a custom
+	// operation, or -1 if path is not an array element.
+	arrayLen int
+}
+
+// applyRecorded applies a single operation and returns its effects, one per
+// location its path matches if it is a JSONPath expression or has wildcards.
+func (p Patch) applyRecorded(pd *container, op Operation, accumulatedCopySize *int64, options *ApplyOptions) ([]*opEffect, error) {
+	ops := Patch{op}
+
+	if isExpandedOperation(op, options) {
+		var err error
+		if ops, err = expandOperation(*pd, op, options); err != nil {
+			return nil, err
+		}
+	}
+
+	effects := make([]*opEffect, 0, len(ops))
+
+	for _, concrete := range ops {
+		e, err := p.recordOperation(pd, concrete, accumulatedCopySize, options)
+		if err != nil {
+			return nil, err
+		}
+
+		if e == nil {
+			continue
+		}
+
+		effects = append(effects, e)
+	}
+
+	return effects, nil
+}
+
+// recordOperation applies a single operation, whose path is a JSON Pointer,
+// and returns its effect, or nil if its "if" clause made it skip.
+func (p Patch) recordOperation(pd *container, op Operation, accumulatedCopySize *int64, options *ApplyOptions) (*opEffect, error) {
+	if holds, err := p.conditionHolds(pd, op, options); err != nil || !holds {
+		return nil, err
+	}
+
+	e := &opEffect{kind: op.Kind()}
+
+	path, pathErr := op.Path()
+	from, fromErr := op.resolveFrom(options)
+
+	if pathErr == nil {
+		switch e.kind {
+		case "remove", "replace", "test":
+			e.path = resolvePath(pd, path, options)
+			e.previous, _ = valueAt(pd, path, options)
+		case "add", "copy":
+			e.previous = overwrittenValue(pd, path, options)
+
+			if e.kind == "add" && options.EnsurePathExistsOnAdd {
+				if con, _ := findObject(pd, path, options); con == nil {
+					e.ancestor, e.ancestorPrevious = existingAncestor(pd, path, options)
+				}
+			}
+		case "move":
+			// Recorded below, as the destination is written once the
+			// source is removed.
+		default:
+			if _, ok := options.CustomOperations[e.kind]; ok {
+				e.custom = true
+				e.path = resolvePath(pd, path, options)
+				e.previous, _ = valueAt(pd, path, options)
+				e.arrayLen = parentArrayLen(pd, path, options)
+			}
+		}
+	}
+
+	if fromErr == nil && (e.kind == "move" || e.kind == "copy") {
+		e.from = resolvePath(pd, from, options)
+	}
+
+	if pathErr == nil && fromErr == nil && e.kind == "move" {
+		e.moved, _ = valueAt(pd, from, options)
+		withoutValue(pd, from, options, func() {
+			e.previous = overwrittenValue(pd, path, options)
+		})
+	}
+
+	if err := p.applyOperation(pd, op, accumulatedCopySize, options); err != nil {
+		return nil, err
+	}
+
+	// The destination of an insertion is only known once it happened.
+	switch e.kind {
+	case "add", "copy", "move":
+		e.path = resolvePath(pd, path, options)
+	}
+
+	if e.custom {
+		// Removing an array element shifts the next one to path.
+		if e.arrayLen >= 0 {
+			e.exists = parentArrayLen(pd, e.path, options) == e.arrayLen
+		} else {
+			_, e.exists = valueAt(pd, e.path, options)
+		}
+	}
+
+	return e, nil
+}
+
+// inverse returns the operations that undo the effect.
+func (e *opEffect) inverse() Patch {
+	switch e.kind {
+	case "add", "copy":
+		if e.ancestorPrevious != nil {
+			return Patch{newValueOperation("replace", e.ancestor, e.ancestorPrevious)}
+		}
+
+		if e.previous != nil {
+			return Patch{newValueOperation("replace", e.path, e.previous)}
+		}
+
+		return Patch{newOperation("remove", e.path)}
+	case "remove":
+		if e.previous == nil {
+			// Nothing was removed, as AllowMissingPathOnRemove was set.
+			return nil
+		}
+
+		return Patch{newValueOperation("add", e.path, e.previous)}
+	case "replace":
+		return Patch{newValueOperation("replace", e.path, e.previous)}
+	case "move":
+		if e.previous == nil {
+			return Patch{newFromOperation("move", e.path, e.from)}
+		}
+
+		// The moved value overwrote the value at path, which was found
+		// with the source of the move removed. Restoring it gives that
+		// document back, to which the moved value is added again.
+		return Patch{
+			newValueOperation("replace", e.path, e.previous),
+			newValueOperation("add", e.from, e.moved),
+		}
+	}
+
+	// A custom operation can only have set or removed the value at path.
+	switch {
+	case !e.custom:
+		return nil
+	case e.previous == nil && e.exists:
+		return Patch{newOperation("remove", e.path)}
+	case e.previous != nil && !e.exists:
+		return Patch{newValueOperation("add", e.path, e.previous)}
+	case e.previous != nil:
+		return Patch{newValueOperation("replace", e.path, e.previous)}
+	}
+
+	return nil
+}
+
+// Invert returns a patch that undoes p. Applying the returned patch to the
+// result of p.Apply(doc) yields a document equal to doc.
+func (p Patch) Invert(doc []byte) (Patch, error) {
+	return p.InvertWithOptions(doc, NewApplyOptions())
+}
+
+// InvertWithOptions returns a patch that undoes p, when p is applied to doc
+// with the passed in ApplyOptions. "test" operations are not part of the
+// returned patch.
+func (p Patch) InvertWithOptions(doc []byte, options *ApplyOptions) (Patch, error) {
+	inverse := Patch{}
+
+	if len(doc) == 0 {
+		return inverse, nil
+	}
+
+	options = options.effective()
+
+	pd, err := newContainer(doc, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var accumulatedCopySize int64
+
+	inverses := make([]Patch, 0, len(p))
+
+	for i, op := range p {
+		effects, err := p.applyRecorded(&pd, op, &accumulatedCopySize, options)
+		if err != nil {
+			return nil, NewPatchError(i, op, err)
+		}
+
+		for _, e := range effects {
+			inverses = append(inverses, e.inverse())
+		}
+	}
+
+	for i := len(inverses) - 1; i >= 0; i-- {
+		inverse = append(inverse, inverses[i]...)
+	}
+
+	return inverse, nil
+}
+
+// resolvePath returns path with every negative array index, and a trailing
+// "-", replaced by the absolute index it refers to in the current state of
+// the document. The path is returned unchanged if it does not resolve.
+func resolvePath(pd *container, path string, options *ApplyOptions) string {
+	split := strings.Split(path, "/")
+
+	if len(split) < 2 {
+		return path
+	}
+
+	doc := *pd
+	parts := split[1:]
+	resolved := make([]string, len(parts))
+
+	for i, part := range parts {
+		if isNullContainer(doc) {
+			return path
+		}
+
+		if ary, ok := doc.(*partialArray); ok {
+			part = resolveIndex(part, len(ary.nodes))
+		}
+		resolved[i] = part
+
+		if i == len(parts)-1 {
+			break
+		}
+
+		next, err := doc.get(decodePatchKey(part), options)
+		if next == nil || err != nil {
+			return path
+		}
+
+		if isArray(*next.raw) {
+			doc, err = next.intoAry()
+		} else {
+			doc, err = next.intoDoc(options)
+		}
+
+		if err != nil {
+			return path
+		}
+	}
+
+	return "/" + strings.Join(resolved, "/")
+}
+
+// resolveIndex turns a token referencing an element of an array of length n
+// into an absolute index. A trailing "-" refers to the last element, which
+// is where an insertion at "-" ends up.
+func resolveIndex(token string, n int) string {
+	if token == "-" {
+		return strconv.Itoa(n - 1)
+	}
+
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx >= 0 {
+		return token
+	}
+
+	return strconv.Itoa(idx + n)
+}
+
+// valueAt returns the encoded value at path, and whether there is one.
+func valueAt(pd *container, path string, options *ApplyOptions) ([]byte, bool) {
+	if path == "" {
+		buf, err := json.MarshalEscaped(*pd, false)
+		return buf, err == nil
+	}
+
+	if isNullContainer(*pd) {
+		return nil, false
+	}
+
+	con, key := findObject(pd, path, options)
+	if con == nil || isNullContainer(con) {
+		return nil, false
+	}
+
+	val, err := con.get(key, options)
+	if err != nil {
+		return nil, false
+	}
+
+	buf, err := json.MarshalEscaped(val, false)
+	if err != nil {
+		return nil, false
+	}
+
+	return buf, true
+}
+
+// parentArrayLen returns the length of the array holding the element at path,
+// or -1 if the parent of path is not an array.
+func parentArrayLen(pd *container, path string, options *ApplyOptions) int {
+	if path == "" || isNullContainer(*pd) {
+		return -1
+	}
+
+	con, _ := findObject(pd, path, options)
+	if ary, ok := con.(*partialArray); ok && ary != nil {
+		return len(ary.nodes)
+	}
+
+	return -1
+}
+
+// overwrittenValue returns the encoded value an insertion at path overwrites,
+// or nil if it inserts into an array or there is no value at path.
+func overwrittenValue(pd *container, path string, options *ApplyOptions) []byte {
+	if path != "" && !isNullContainer(*pd) {
+		con, _ := findObject(pd, path, options)
+		if _, ok := con.(*partialArray); ok {
+			return nil
+		}
+	}
+
+	val, _ := valueAt(pd, path, options)
+	return val
+}
+
+// withoutValue calls f with the value at path removed from the document, and
+// puts the value back afterwards. f is called on the document as is if there
+// is no value to remove.
+func withoutValue(pd *container, path string, options *ApplyOptions, f func()) {
+	if path == "" || isNullContainer(*pd) {
+		f()
+		return
+	}
+
+	con, key := findObject(pd, path, options)
+	if con == nil || isNullContainer(con) {
+		f()
+		return
+	}
+
+	undo := restorer(con)
+
+	if err := con.remove(key, options); err != nil {
+		f()
+		return
+	}
+
+	f()
+	undo()
+}
+
+// isNullContainer reports whether con holds no object or array, as when the
+// whole document was replaced with null.
+func isNullContainer(con container) bool {
+	switch c := con.(type) {
+	case *partialDoc:
+		return c == nil
+	case *partialArray:
+		return c == nil
+	}
+
+	return con == nil
+}
+
+// existingAncestor returns the deepest parent of path that exists in the
+// document, together with its value.
+func existingAncestor(pd *container, path string, options *ApplyOptions) (string, []byte) {
+	split := strings.Split(path, "/")
+
+	for i := len(split) - 1; i > 1; i-- {
+		parent := strings.Join(split[:i], "/")
+
+		if con, _ := findObject(pd, parent, options); con == nil {
+			continue
+		}
+
+		if val, ok := valueAt(pd, parent, options); ok {
+			return resolvePath(pd, parent, options), val
+		}
+	}
+
+	val, _ := valueAt(pd, "", options)
+	return "", val
+}
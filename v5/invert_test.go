@@ -0,0 +1,192 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var InvertCases = []struct {
+	doc, patch string
+}{
+	{`{"a": 1}`, `[{"op": "add", "path": "/b", "value": 2}]`},
+	{`{"a": 1}`, `[{"op": "add", "path": "/a", "value": 2}]`},
+	{`{"a": 1, "b": {"c": [1, 2]}}`, `[{"op": "remove", "path": "/b"}]`},
+	{`{"a": 1}`, `[{"op": "replace", "path": "/a", "value": {"x": null}}]`},
+	{`{"a": [1, 2, 3]}`, `[{"op": "add", "path": "/a/1", "value": 4}]`},
+	{`{"a": [1, 2, 3]}`, `[{"op": "add", "path": "/a/-", "value": 4}]`},
+	{`{"a": [1, 2, 3]}`, `[{"op": "add", "path": "/a/-1", "value": 4}]`},
+	{`{"a": [1, 2, 3]}`, `[{"op": "remove", "path": "/a/-1"}]`},
+	{`{"a": [1, 2, 3]}`, `[{"op": "replace", "path": "/a/-3", "value": 0}]`},
+	{`{"a": [[1], [2]]}`, `[{"op": "add", "path": "/a/-1/0", "value": 3}]`},
+	{`{"a": [1, 2, 3]}`, `[{"op": "move", "from": "/a/0", "path": "/a/-"}]`},
+	{`{"a": [1, 2, 3]}`, `[{"op": "move", "from": "/a/2", "path": "/a/0"}]`},
+	{`{"a": {"b": 1}, "c": 2}`, `[{"op": "move", "from": "/a/b", "path": "/c"}]`},
+	{`{"a": {"b": 1}, "c": 2}`, `[{"op": "move", "from": "/a/b", "path": "/d"}]`},
+	{`{"a": {"b": 1, "c": 2}}`, `[{"op": "move", "from": "/a/b", "path": "/a"}]`},
+	{`[1, {"a": "old"}]`, `[{"op": "move", "from": "/0", "path": "/0/a"}]`},
+	{`{"a": [1, {"b": 2}]}`, `[{"op": "move", "from": "/a/0", "path": "/a/0/b"}]`},
+	{`{"a": {"b": 1}, "c": 2}`, `[{"op": "copy", "from": "/a", "path": "/c"}]`},
+	{`{"a": {"b": 1}, "c": [2]}`, `[{"op": "copy", "from": "/a", "path": "/c/0"}]`},
+	{`{"a": 1}`, `[{"op": "test", "path": "/a", "value": 1}]`},
+	{`{"a": 1}`, `[{"op": "replace", "path": "", "value": [1, 2]}]`},
+	{`[1, 2]`, `[{"op": "add", "path": "", "value": {"a": 1}}]`},
+	{
+		`{"a": [1, {"b": 2}], "c": "d"}`,
+		`[
+			{"op": "add", "path": "/a/1/e", "value": 3},
+			{"op": "move", "from": "/a/0", "path": "/a/0/f"},
+			{"op": "remove", "path": "/c"},
+			{"op": "copy", "from": "/a/0", "path": "/c"},
+			{"op": "replace", "path": "/a/0/b", "value": null}
+		]`,
+	},
+}
+
+func TestInvert(t *testing.T) {
+	for _, c := range InvertCases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		inverse, err := p.Invert([]byte(c.doc))
+		if err != nil {
+			t.Fatalf("Unable to invert patch %s: %s", c.patch, err)
+		}
+
+		modified, err := p.Apply([]byte(c.doc))
+		if err != nil {
+			t.Fatalf("Unable to apply patch %s: %s", c.patch, err)
+		}
+
+		out, err := inverse.Apply(modified)
+		if err != nil {
+			t.Fatalf("Unable to apply inverse of %s: %s", c.patch, err)
+		}
+
+		if !compareJSON(string(out), c.doc) {
+			inv, _ := json.Marshal(inverse)
+			t.Errorf("Inverse of %s did not restore the document. Expected:\n%s\n\nActual:\n%s\n\nInverse:\n%s",
+				c.patch, c.doc, out, inv)
+		}
+	}
+}
+
+func TestInvertOperations(t *testing.T) {
+	cases := []struct {
+		doc, patch, inverse string
+	}{
+		{
+			`{"a": [1, 2, 3]}`,
+			`[{"op": "add", "path": "/a/-", "value": 4}, {"op": "remove", "path": "/a/0"}]`,
+			`[{"op": "add", "path": "/a/0", "value": 1}, {"op": "remove", "path": "/a/3"}]`,
+		},
+		{
+			`{"a": {"b": 1}, "c": 2}`,
+			`[{"op": "move", "from": "/a/b", "path": "/c"}]`,
+			`[{"op": "replace", "path": "/c", "value": 2}, {"op": "add", "path": "/a/b", "value": 1}]`,
+		},
+		{
+			`[1, {"a": "old"}]`,
+			`[{"op": "move", "from": "/0", "path": "/0/a"}]`,
+			`[{"op": "replace", "path": "/0/a", "value": "old"}, {"op": "add", "path": "/0", "value": 1}]`,
+		},
+		{
+			`{"a": 1}`,
+			`[{"op": "test", "path": "/a", "value": 1}, {"op": "replace", "path": "/a", "value": 2}]`,
+			`[{"op": "replace", "path": "/a", "value": 1}]`,
+		},
+	}
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		inverse, err := p.Invert([]byte(c.doc))
+		if err != nil {
+			t.Fatalf("Unable to invert patch %s: %s", c.patch, err)
+		}
+
+		out, err := json.Marshal(inverse)
+		if err != nil {
+			t.Fatalf("Unable to marshal inverse: %s", err)
+		}
+
+		if !compareJSON(string(out), c.inverse) {
+			t.Errorf("Unexpected inverse of %s. Expected:\n%s\n\nActual:\n%s", c.patch, c.inverse, out)
+		}
+	}
+}
+
+func TestInvertWithOptions(t *testing.T) {
+	cases := []struct {
+		doc, patch string
+		options    *ApplyOptions
+	}{
+		{
+			`{"a": 1}`,
+			`[{"op": "remove", "path": "/b"}, {"op": "remove", "path": "/a"}]`,
+			&ApplyOptions{AllowMissingPathOnRemove: true},
+		},
+		{
+			`{"a": {"b": 1}}`,
+			`[{"op": "add", "path": "/a/c/d/0", "value": 2}]`,
+			&ApplyOptions{EnsurePathExistsOnAdd: true},
+		},
+		{
+			`{"a": [1]}`,
+			`[{"op": "add", "path": "/a/3/x", "value": 2}]`,
+			&ApplyOptions{EnsurePathExistsOnAdd: true},
+		},
+	}
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		inverse, err := p.InvertWithOptions([]byte(c.doc), c.options)
+		if err != nil {
+			t.Fatalf("Unable to invert patch %s: %s", c.patch, err)
+		}
+
+		modified, err := p.ApplyWithOptions([]byte(c.doc), c.options)
+		if err != nil {
+			t.Fatalf("Unable to apply patch %s: %s", c.patch, err)
+		}
+
+		out, err := inverse.ApplyWithOptions(modified, c.options)
+		if err != nil {
+			t.Fatalf("Unable to apply inverse of %s: %s", c.patch, err)
+		}
+
+		if !compareJSON(string(out), c.doc) {
+			t.Errorf("Inverse of %s did not restore the document. Expected:\n%s\n\nActual:\n%s", c.patch, c.doc, out)
+		}
+	}
+}
+
+func TestInvertFailingPatch(t *testing.T) {
+	cases := []struct {
+		doc, patch string
+	}{
+		{`{"a": 1}`, `[{"op": "remove", "path": "/b"}]`},
+		{`{"a": {"b": 1}}`, `[{"op": "replace", "path": "", "value": null}, {"op": "remove", "path": "/a"}]`},
+		{`{"a": {"b": 1}}`, `[{"op": "replace", "path": "", "value": null}, {"op": "add", "path": "/a", "value": 1}]`},
+		{`{"a": {"b": 1}}`, `[{"op": "replace", "path": "", "value": null}, {"op": "move", "from": "/a", "path": "/b"}]`},
+	}
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := p.Invert([]byte(c.doc)); err == nil {
+			t.Errorf("Inverting %s, which does not apply to %s, should fail", c.patch, c.doc)
+		}
+	}
+}
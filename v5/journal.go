@@ -0,0 +1,66 @@
+package jsonpatch
+
+// JournalEntry records the effect of a single operation applied by
+// ApplyWithJournal.
+type JournalEntry struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	// Op is the kind of the operation, such as "add".
+	Op string
+	// Path is the path the operation applied to, with negative array indices
+	// and "-" resolved to absolute indices.
+	Path string
+	// From is the resolved "from" path of "move" and "copy" operations.
+	From string
+	// Previous is the JSON encoded value at Path before the operation, or nil
+	// if there was none, such as when inserting into an array. For a "move",
+	// it is the value at Path once the value at From was removed.
+	Previous []byte
+}
+
+// ApplyWithJournal mutates a JSON document according to the patch and the
+// passed in ApplyOptions. It returns the new document, along with one
+// JournalEntry per operation describing what the operation overwrote. An
+// operation whose path is a JSONPath expression or has wildcards has one
+// JournalEntry per location it applied to, and one skipped for its "if"
+// clause has none.
+func (p Patch) ApplyWithJournal(doc []byte, options *ApplyOptions) ([]byte, []JournalEntry, error) {
+	if len(doc) == 0 {
+		return doc, []JournalEntry{}, nil
+	}
+
+	options = options.effective()
+
+	pd, err := newContainer(doc, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var accumulatedCopySize int64
+
+	journal := make([]JournalEntry, 0, len(p))
+
+	for i, op := range p {
+		effects, err := p.applyRecorded(&pd, op, &accumulatedCopySize, options)
+		if err != nil {
+			return nil, nil, NewPatchError(i, op, err)
+		}
+
+		for _, e := range effects {
+			journal = append(journal, JournalEntry{
+				Index:    i,
+				Op:       e.kind,
+				Path:     e.path,
+				From:     e.from,
+				Previous: e.previous,
+			})
+		}
+	}
+
+	out, err := marshalContainer(pd, "", options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, journal, nil
+}
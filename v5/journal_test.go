@@ -0,0 +1,99 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyWithJournal(t *testing.T) {
+	doc := `{"a": [1, 2, 3], "b": {"c": "d"}, "e": null}`
+	patch := `[
+		{"op": "replace", "path": "/b/c", "value": "x"},
+		{"op": "add", "path": "/a/-", "value": 4},
+		{"op": "remove", "path": "/a/-4"},
+		{"op": "move", "from": "/b", "path": "/e"},
+		{"op": "copy", "from": "/a/0", "path": "/f"},
+		{"op": "test", "path": "/f", "value": 2}
+	]`
+
+	p, err := DecodePatch([]byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, journal, err := p.ApplyWithJournal([]byte(doc), NewApplyOptions())
+	if err != nil {
+		t.Fatalf("Unable to apply patch: %s", err)
+	}
+
+	expected, err := p.Apply([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !compareJSON(string(out), string(expected)) {
+		t.Errorf("Unexpected document. Expected:\n%s\n\nActual:\n%s", expected, out)
+	}
+
+	entries := []JournalEntry{
+		{Index: 0, Op: "replace", Path: "/b/c", Previous: []byte(`"d"`)},
+		{Index: 1, Op: "add", Path: "/a/3"},
+		{Index: 2, Op: "remove", Path: "/a/0", Previous: []byte(`1`)},
+		{Index: 3, Op: "move", Path: "/e", From: "/b", Previous: []byte(`null`)},
+		{Index: 4, Op: "copy", Path: "/f", From: "/a/0"},
+		{Index: 5, Op: "test", Path: "/f", Previous: []byte(`2`)},
+	}
+
+	if len(journal) != len(entries) {
+		t.Fatalf("Expected %d journal entries, got %d", len(entries), len(journal))
+	}
+
+	for i, e := range entries {
+		if !reflect.DeepEqual(e, journal[i]) {
+			t.Errorf("Unexpected journal entry %d. Expected:\n%+v\n\nActual:\n%+v", i, e, journal[i])
+		}
+	}
+}
+
+func TestApplyWithJournalMoveIntoSibling(t *testing.T) {
+	p, err := DecodePatch([]byte(`[{"op": "move", "from": "/0", "path": "/0/a"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, journal, err := p.ApplyWithJournal([]byte(`[1, {"a": "old"}]`), NewApplyOptions())
+	if err != nil {
+		t.Fatalf("Unable to apply patch: %s", err)
+	}
+
+	expected := JournalEntry{Index: 0, Op: "move", Path: "/0/a", From: "/0", Previous: []byte(`"old"`)}
+
+	if len(journal) != 1 || !reflect.DeepEqual(journal[0], expected) {
+		t.Errorf("Unexpected journal. Expected:\n%+v\n\nActual:\n%+v", expected, journal)
+	}
+}
+
+func TestApplyWithJournalFailure(t *testing.T) {
+	cases := []struct {
+		doc, patch string
+	}{
+		{`{}`, `[{"op": "add", "path": "/a", "value": 1}, {"op": "remove", "path": "/b"}]`},
+		{`{"a": {"b": 1}}`, `[{"op": "replace", "path": "", "value": null}, {"op": "remove", "path": "/a"}]`},
+	}
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, journal, err := p.ApplyWithJournal([]byte(c.doc), NewApplyOptions())
+		if err == nil {
+			t.Fatalf("Applying %s: expected an error", c.patch)
+		}
+
+		if out != nil || journal != nil {
+			t.Errorf("Applying %s: expected no document and no journal on failure", c.patch)
+		}
+	}
+}
@@ -0,0 +1,1328 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// ErrInvalidJSONPath is returned when the path of an operation is not a valid
+// RFC 9535 JSONPath expression.
+var ErrInvalidJSONPath = errors.New("invalid JSONPath expression")
+
+// expandJSONPath returns one copy of op per location its JSONPath matches in
+// doc, with the "path" of each set to the JSON Pointer of the location.
+func expandJSONPath(doc container, op Operation, options *ApplyOptions) (Patch, error) {
+	path, err := op.Path()
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// An inserting operation may target a member that does not exist yet,
+	// which a JSONPath expression cannot match, so it is appended to the
+	// matches of the rest of the expression instead.
+	member, insert := "", false
+	switch op.Kind() {
+	case "add", "copy", "move":
+		if n := len(q.segments); n > 0 {
+			last := q.segments[n-1]
+			if !last.descendant && len(last.selectors) == 1 && last.selectors[0].kind == selectName {
+				member, insert = last.selectors[0].name, true
+				q = &jsonPath{segments: q.segments[:n-1]}
+			}
+		}
+	}
+
+	root := &lazyNode{which: eDoc}
+	switch d := doc.(type) {
+	case *partialDoc:
+		root.doc = d
+	case *partialArray:
+		root.ary, root.which = d, eAry
+	}
+
+	e := &jsonPathEval{root: jsonPathNode{value: root}, options: options}
+
+	nodes, err := e.query(q, e.root)
+	if err != nil {
+		return nil, err
+	}
+
+	if insert {
+		var parents []jsonPathNode
+		for _, n := range nodes {
+			if nodeKind(n.value) != kindObject {
+				continue
+			}
+
+			d, err := n.value.intoDoc(options)
+			if err != nil {
+				return nil, err
+			}
+
+			pos := len(d.keys)
+			for i, k := range d.keys {
+				if k == member {
+					pos = i
+					break
+				}
+			}
+
+			parents = append(parents, n.child(member, pos, nil))
+		}
+		nodes = parents
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return comparePositions(nodes[i].positions, nodes[j].positions) > 0
+	})
+
+	ops := Patch{}
+	for i, n := range nodes {
+		if i > 0 && comparePositions(n.positions, nodes[i-1].positions) == 0 {
+			continue
+		}
+
+		concrete := make(Operation, len(op))
+		for k, v := range op {
+			concrete[k] = v
+		}
+		concrete.SetPath(NewPointer(n.tokens...))
+
+		ops = append(ops, concrete)
+	}
+
+	return ops, nil
+}
+
+// comparePositions orders locations in document order, with a value before
+// the values it contains.
+func comparePositions(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+const (
+	selectName = iota
+	selectWildcard
+	selectIndex
+	selectSlice
+	selectFilter
+)
+
+// jsonPath is a parsed JSONPath query, either from the root of the document
+// ("$") or, within a filter, from the current node ("@").
+type jsonPath struct {
+	relative bool
+	segments []jsonPathSegment
+}
+
+type jsonPathSegment struct {
+	descendant bool
+	selectors  []jsonPathSelector
+}
+
+type jsonPathSelector struct {
+	kind  int
+	name  string
+	index int
+	// slice holds the start, end and step of a slice selector, nil when
+	// they are left out.
+	slice  [3]*int
+	filter logicalExpr
+}
+
+// singular reports whether the query matches at most one node.
+func (q *jsonPath) singular() bool {
+	for _, s := range q.segments {
+		if s.descendant || len(s.selectors) != 1 {
+			return false
+		}
+
+		if k := s.selectors[0].kind; k != selectName && k != selectIndex {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterValue is the value of an expression within a filter. Nothing is
+// represented by ok being false, which differs from a JSON null.
+type filterValue struct {
+	v  interface{}
+	ok bool
+}
+
+type logicalExpr interface {
+	test(e *jsonPathEval, current jsonPathNode) (bool, error)
+}
+
+type valueExpr interface {
+	value(e *jsonPathEval, current jsonPathNode) (filterValue, error)
+}
+
+type orExpr []logicalExpr
+
+type andExpr []logicalExpr
+
+type notExpr struct {
+	expr logicalExpr
+}
+
+// existsExpr tests whether a query matches any node.
+type existsExpr struct {
+	query *jsonPath
+}
+
+type compareExpr struct {
+	op          string
+	left, right valueExpr
+}
+
+type literalExpr struct {
+	v interface{}
+}
+
+// singularQueryExpr is the value of the node a singular query matches.
+type singularQueryExpr struct {
+	query *jsonPath
+}
+
+// functionExpr is a call to one of the function extensions of RFC 9535.
+type functionExpr struct {
+	name string
+	args []functionArg
+}
+
+// functionArg is either a query whose nodes are passed to the function, or an
+// expression whose value is.
+type functionArg struct {
+	query *jsonPath
+	value valueExpr
+}
+
+// parseJSONPath parses an RFC 9535 JSONPath query.
+func parseJSONPath(s string) (*jsonPath, error) {
+	p := &jsonPathParser{s: s}
+
+	q, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+
+	return q, nil
+}
+
+type jsonPathParser struct {
+	s   string
+	pos int
+}
+
+func (p *jsonPathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%q at offset %d: %s: %w", p.s, p.pos, fmt.Sprintf(format, args...), ErrInvalidJSONPath)
+}
+
+func (p *jsonPathParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+
+	return 0
+}
+
+func (p *jsonPathParser) skipBlank() {
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonPathParser) consume(token string) bool {
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+
+	return false
+}
+
+// query parses a query starting with "$" or "@".
+func (p *jsonPathParser) query() (*jsonPath, error) {
+	q := &jsonPath{}
+
+	switch p.peek() {
+	case '$':
+	case '@':
+		q.relative = true
+	default:
+		return nil, p.errorf("expected '$' or '@'")
+	}
+	p.pos++
+
+	for {
+		start := p.pos
+		p.skipBlank()
+
+		if c := p.peek(); c != '.' && c != '[' {
+			p.pos = start
+			return q, nil
+		}
+
+		seg, err := p.segment()
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, seg)
+	}
+}
+
+func (p *jsonPathParser) segment() (jsonPathSegment, error) {
+	var seg jsonPathSegment
+
+	if p.consume("..") {
+		seg.descendant = true
+		if p.peek() == '[' {
+			return p.bracketed(seg)
+		}
+	} else if !p.consume(".") {
+		return p.bracketed(seg)
+	}
+
+	if p.consume("*") {
+		seg.selectors = []jsonPathSelector{{kind: selectWildcard}}
+		return seg, nil
+	}
+
+	name := p.memberName()
+	if name == "" {
+		return seg, p.errorf("expected a member name")
+	}
+
+	seg.selectors = []jsonPathSelector{{kind: selectName, name: name}}
+	return seg, nil
+}
+
+func (p *jsonPathParser) memberName() string {
+	start := p.pos
+
+	for p.pos < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= 0x80:
+		case r >= '0' && r <= '9' && p.pos > start:
+		default:
+			return p.s[start:p.pos]
+		}
+
+		p.pos += size
+	}
+
+	return p.s[start:p.pos]
+}
+
+func (p *jsonPathParser) bracketed(seg jsonPathSegment) (jsonPathSegment, error) {
+	if !p.consume("[") {
+		return seg, p.errorf("expected '['")
+	}
+
+	for {
+		p.skipBlank()
+
+		sel, err := p.selector()
+		if err != nil {
+			return seg, err
+		}
+		seg.selectors = append(seg.selectors, sel)
+
+		p.skipBlank()
+
+		if p.consume("]") {
+			return seg, nil
+		}
+
+		if !p.consume(",") {
+			return seg, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+func (p *jsonPathParser) selector() (jsonPathSelector, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		name, err := p.stringLiteral()
+		return jsonPathSelector{kind: selectName, name: name}, err
+	case c == '*':
+		p.pos++
+		return jsonPathSelector{kind: selectWildcard}, nil
+	case c == '?':
+		p.pos++
+		p.skipBlank()
+
+		expr, err := p.logicalOr()
+		return jsonPathSelector{kind: selectFilter, filter: expr}, err
+	}
+
+	var bounds [3]*int
+
+	for i := range bounds {
+		if i > 0 {
+			p.skipBlank()
+			if !p.consume(":") {
+				break
+			}
+			p.skipBlank()
+		}
+
+		if c := p.peek(); c == '-' || c >= '0' && c <= '9' {
+			n, err := p.integer()
+			if err != nil {
+				return jsonPathSelector{}, err
+			}
+			bounds[i] = &n
+		}
+
+		if i == 0 {
+			start := p.pos
+			p.skipBlank()
+
+			if p.peek() != ':' {
+				p.pos = start
+				if bounds[0] == nil {
+					return jsonPathSelector{}, p.errorf("expected a selector")
+				}
+				return jsonPathSelector{kind: selectIndex, index: *bounds[0]}, nil
+			}
+		}
+	}
+
+	return jsonPathSelector{kind: selectSlice, slice: bounds}, nil
+}
+
+// integer parses an integer within the range of I-JSON.
+func (p *jsonPathParser) integer() (int, error) {
+	start := p.pos
+	p.consume("-")
+
+	digits := p.pos
+	for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+		p.pos++
+	}
+
+	s := p.s[start:p.pos]
+	if p.pos == digits || p.s[digits] == '0' && (p.pos-digits > 1 || digits > start) {
+		return 0, p.errorf("invalid integer %q", s)
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n > 1<<53-1 || n < -(1<<53-1) {
+		return 0, p.errorf("integer %q out of range", s)
+	}
+
+	return int(n), nil
+}
+
+func (p *jsonPathParser) stringLiteral() (string, error) {
+	quote := p.peek()
+	p.pos++
+
+	var sb strings.Builder
+
+	for {
+		if p.pos >= len(p.s) {
+			return "", p.errorf("unterminated string")
+		}
+
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		p.pos += size
+
+		switch {
+		case r == rune(quote):
+			return sb.String(), nil
+		case r < 0x20:
+			return "", p.errorf("control character in string")
+		case r != '\\':
+			sb.WriteRune(r)
+			continue
+		}
+
+		if p.pos >= len(p.s) {
+			return "", p.errorf("unterminated string")
+		}
+
+		c := p.s[p.pos]
+		p.pos++
+
+		switch c {
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case '/', '\\':
+			sb.WriteByte(c)
+		case 'u':
+			r, err := p.unicodeEscape()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(r)
+		default:
+			if c != quote {
+				return "", p.errorf("invalid escape '\\%c'", c)
+			}
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// unicodeEscape parses the hex digits of a "\u" escape, along with the low
+// surrogate following a high one.
+func (p *jsonPathParser) unicodeEscape() (rune, error) {
+	hex := func() (rune, error) {
+		if p.pos+4 > len(p.s) {
+			return 0, p.errorf("invalid unicode escape")
+		}
+
+		n, err := strconv.ParseUint(p.s[p.pos:p.pos+4], 16, 16)
+		if err != nil {
+			return 0, p.errorf("invalid unicode escape")
+		}
+
+		p.pos += 4
+		return rune(n), nil
+	}
+
+	r, err := hex()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case r >= 0xDC00 && r <= 0xDFFF:
+		return 0, p.errorf("unpaired low surrogate")
+	case r < 0xD800 || r > 0xDBFF:
+		return r, nil
+	}
+
+	if !p.consume(`\u`) {
+		return 0, p.errorf("unpaired high surrogate")
+	}
+
+	low, err := hex()
+	if err != nil {
+		return 0, err
+	}
+
+	if low < 0xDC00 || low > 0xDFFF {
+		return 0, p.errorf("unpaired high surrogate")
+	}
+
+	return utf16.DecodeRune(r, low), nil
+}
+
+func (p *jsonPathParser) logicalOr() (logicalExpr, error) {
+	var or orExpr
+
+	for {
+		expr, err := p.logicalAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, expr)
+
+		start := p.pos
+		p.skipBlank()
+
+		if !p.consume("||") {
+			p.pos = start
+			break
+		}
+		p.skipBlank()
+	}
+
+	if len(or) == 1 {
+		return or[0], nil
+	}
+
+	return or, nil
+}
+
+func (p *jsonPathParser) logicalAnd() (logicalExpr, error) {
+	var and andExpr
+
+	for {
+		expr, err := p.basic()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, expr)
+
+		start := p.pos
+		p.skipBlank()
+
+		if !p.consume("&&") {
+			p.pos = start
+			break
+		}
+		p.skipBlank()
+	}
+
+	if len(and) == 1 {
+		return and[0], nil
+	}
+
+	return and, nil
+}
+
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// basic parses a parenthesized expression, a comparison, or a test.
+func (p *jsonPathParser) basic() (logicalExpr, error) {
+	if p.consume("!") {
+		p.skipBlank()
+
+		var expr logicalExpr
+		var err error
+
+		if p.peek() == '(' {
+			expr, err = p.parenthesized()
+		} else {
+			expr, err = p.test()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return notExpr{expr: expr}, nil
+	}
+
+	if p.peek() == '(' {
+		return p.parenthesized()
+	}
+
+	start := p.pos
+
+	left, err := p.comparable()
+	if err != nil {
+		// Not a comparison, so it has to be a test.
+		p.pos = start
+		return p.test()
+	}
+
+	p.skipBlank()
+
+	op := ""
+	for _, o := range comparisonOperators {
+		if p.consume(o) {
+			op = o
+			break
+		}
+	}
+
+	if op == "" {
+		p.pos = start
+		return p.test()
+	}
+
+	p.skipBlank()
+
+	right, err := p.comparable()
+	if err != nil {
+		return nil, err
+	}
+
+	return compareExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *jsonPathParser) parenthesized() (logicalExpr, error) {
+	p.consume("(")
+	p.skipBlank()
+
+	expr, err := p.logicalOr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipBlank()
+
+	if !p.consume(")") {
+		return nil, p.errorf("expected ')'")
+	}
+
+	return expr, nil
+}
+
+// test parses a query tested for matching any node, or a call to a function
+// returning a logical value.
+func (p *jsonPathParser) test() (logicalExpr, error) {
+	if c := p.peek(); c == '$' || c == '@' {
+		q, err := p.query()
+		if err != nil {
+			return nil, err
+		}
+
+		return existsExpr{query: q}, nil
+	}
+
+	if c := p.peek(); c >= 'a' && c <= 'z' {
+		f, err := p.function()
+		if err != nil {
+			return nil, err
+		}
+
+		if f.name != "match" && f.name != "search" {
+			return nil, p.errorf("the result of %s() cannot be tested", f.name)
+		}
+
+		return f, nil
+	}
+
+	return nil, p.errorf("expected a filter expression")
+}
+
+// comparable parses a literal, a singular query, or a call to a function
+// returning a value.
+func (p *jsonPathParser) comparable() (valueExpr, error) {
+	switch c := p.peek(); {
+	case c == '$' || c == '@':
+		q, err := p.query()
+		if err != nil {
+			return nil, err
+		}
+
+		if !q.singular() {
+			return nil, p.errorf("only a singular query can be compared")
+		}
+
+		return singularQueryExpr{query: q}, nil
+	case c == '\'' || c == '"':
+		s, err := p.stringLiteral()
+		return literalExpr{v: s}, err
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	case p.consume("true"):
+		return literalExpr{v: true}, nil
+	case p.consume("false"):
+		return literalExpr{v: false}, nil
+	case p.consume("null"):
+		return literalExpr{v: nil}, nil
+	case c >= 'a' && c <= 'z':
+		f, err := p.function()
+		if err != nil {
+			return nil, err
+		}
+
+		if f.name == "match" || f.name == "search" {
+			return nil, p.errorf("the result of %s() cannot be compared", f.name)
+		}
+
+		return f, nil
+	}
+
+	return nil, p.errorf("expected a value")
+}
+
+// number parses a JSON number, which may also be "-0".
+func (p *jsonPathParser) number() (valueExpr, error) {
+	start := p.pos
+	p.consume("-")
+
+	digits := func() int {
+		n := leadingDigits(p.s[p.pos:])
+		p.pos += n
+		return n
+	}
+
+	intStart := p.pos
+	n := digits()
+	if n == 0 || n > 1 && p.s[intStart] == '0' {
+		return nil, p.errorf("invalid number %q", p.s[start:p.pos])
+	}
+
+	if p.consume(".") && digits() == 0 {
+		return nil, p.errorf("invalid number %q", p.s[start:p.pos])
+	}
+
+	if p.consume("e") || p.consume("E") {
+		if !p.consume("+") {
+			p.consume("-")
+		}
+
+		if digits() == 0 {
+			return nil, p.errorf("invalid number %q", p.s[start:p.pos])
+		}
+	}
+
+	f, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", p.s[start:p.pos])
+	}
+
+	return literalExpr{v: f}, nil
+}
+
+// function parses a call to a function extension, and checks its arguments
+// are of the types the function takes.
+func (p *jsonPathParser) function() (*functionExpr, error) {
+	start := p.pos
+
+	for c := p.peek(); c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_'; c = p.peek() {
+		p.pos++
+	}
+
+	f := &functionExpr{name: p.s[start:p.pos]}
+
+	var params []bool // whether each parameter takes nodes rather than a value
+
+	switch f.name {
+	case "length":
+		params = []bool{false}
+	case "count", "value":
+		params = []bool{true}
+	case "match", "search":
+		params = []bool{false, false}
+	default:
+		p.pos = start
+		return nil, p.errorf("unknown function %q", f.name)
+	}
+
+	if !p.consume("(") {
+		return nil, p.errorf("expected '('")
+	}
+
+	for i := range params {
+		p.skipBlank()
+
+		if i > 0 && !p.consume(",") {
+			return nil, p.errorf("%s() takes %d arguments", f.name, len(params))
+		}
+		p.skipBlank()
+
+		var arg functionArg
+
+		if c := p.peek(); params[i] {
+			if c != '$' && c != '@' {
+				return nil, p.errorf("%s() takes a query", f.name)
+			}
+
+			q, err := p.query()
+			if err != nil {
+				return nil, err
+			}
+			arg.query = q
+		} else {
+			v, err := p.comparable()
+			if err != nil {
+				return nil, err
+			}
+			arg.value = v
+		}
+
+		f.args = append(f.args, arg)
+	}
+
+	p.skipBlank()
+
+	if !p.consume(")") {
+		return nil, p.errorf("%s() takes %d arguments", f.name, len(params))
+	}
+
+	return f, nil
+}
+
+// jsonPathNode is a value of the document along with its location, as
+// reference tokens and as the position of each token within its parent.
+type jsonPathNode struct {
+	value     *lazyNode
+	tokens    []string
+	positions []int
+}
+
+func (n jsonPathNode) child(token string, pos int, value *lazyNode) jsonPathNode {
+	c := jsonPathNode{
+		value:     value,
+		tokens:    make([]string, len(n.tokens)+1),
+		positions: make([]int, len(n.positions)+1),
+	}
+
+	copy(c.tokens, n.tokens)
+	copy(c.positions, n.positions)
+	c.tokens[len(n.tokens)] = token
+	c.positions[len(n.positions)] = pos
+
+	return c
+}
+
+type jsonPathEval struct {
+	root    jsonPathNode
+	options *ApplyOptions
+}
+
+func (e *jsonPathEval) query(q *jsonPath, current jsonPathNode) ([]jsonPathNode, error) {
+	nodes := []jsonPathNode{e.root}
+	if q.relative {
+		nodes = []jsonPathNode{current}
+	}
+
+	for _, seg := range q.segments {
+		var next []jsonPathNode
+
+		for _, n := range nodes {
+			var err error
+			if seg.descendant {
+				next, err = e.descend(n, seg.selectors, next)
+			} else {
+				next, err = e.selectChildren(n, seg.selectors, next)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		nodes = next
+	}
+
+	return nodes, nil
+}
+
+// descend applies the selectors to n and to every value it contains.
+func (e *jsonPathEval) descend(n jsonPathNode, selectors []jsonPathSelector, out []jsonPathNode) ([]jsonPathNode, error) {
+	out, err := e.selectChildren(n, selectors, out)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := e.children(n)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range children {
+		if out, err = e.descend(c, selectors, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// children returns the members of an object or the elements of an array.
+func (e *jsonPathEval) children(n jsonPathNode) ([]jsonPathNode, error) {
+	var children []jsonPathNode
+
+	switch nodeKind(n.value) {
+	case kindObject:
+		d, err := n.value.intoDoc(e.options)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, k := range d.keys {
+			children = append(children, n.child(k, i, d.obj[k]))
+		}
+	case kindArray:
+		a, err := n.value.intoAry()
+		if err != nil {
+			return nil, err
+		}
+
+		for i, v := range a.nodes {
+			children = append(children, n.child(strconv.Itoa(i), i, v))
+		}
+	}
+
+	return children, nil
+}
+
+func (e *jsonPathEval) selectChildren(n jsonPathNode, selectors []jsonPathSelector, out []jsonPathNode) ([]jsonPathNode, error) {
+	kind := nodeKind(n.value)
+	if kind != kindObject && kind != kindArray {
+		return out, nil
+	}
+
+	children, err := e.children(n)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sel := range selectors {
+		switch sel.kind {
+		case selectName:
+			if kind != kindObject {
+				continue
+			}
+
+			for _, c := range children {
+				if c.tokens[len(c.tokens)-1] == sel.name {
+					out = append(out, c)
+					break
+				}
+			}
+		case selectWildcard:
+			out = append(out, children...)
+		case selectIndex:
+			if kind != kindArray {
+				continue
+			}
+
+			idx := sel.index
+			if idx < 0 {
+				idx += len(children)
+			}
+
+			if idx >= 0 && idx < len(children) {
+				out = append(out, children[idx])
+			}
+		case selectSlice:
+			if kind != kindArray {
+				continue
+			}
+
+			for _, idx := range sliceIndices(sel.slice, len(children)) {
+				out = append(out, children[idx])
+			}
+		case selectFilter:
+			for _, c := range children {
+				ok, err := sel.filter.test(e, c)
+				if err != nil {
+					return nil, err
+				}
+
+				if ok {
+					out = append(out, c)
+				}
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// sliceIndices returns the indices a slice selects in an array of length n,
+// as specified by RFC 9535 section 2.3.4.2.
+func sliceIndices(slice [3]*int, n int) []int {
+	step := 1
+	if slice[2] != nil {
+		step = *slice[2]
+	}
+
+	if step == 0 {
+		return nil
+	}
+
+	normalize := func(i *int, def int) int {
+		if i == nil {
+			return def
+		}
+
+		if *i < 0 {
+			return n + *i
+		}
+
+		return *i
+	}
+
+	clamp := func(i, lo, hi int) int {
+		if i < lo {
+			return lo
+		}
+
+		if i > hi {
+			return hi
+		}
+
+		return i
+	}
+
+	var indices []int
+
+	if step > 0 {
+		lower := clamp(normalize(slice[0], 0), 0, n)
+		upper := clamp(normalize(slice[1], n), 0, n)
+
+		for i := lower; i < upper; i += step {
+			indices = append(indices, i)
+		}
+	} else {
+		upper := clamp(normalize(slice[0], n-1), -1, n-1)
+		lower := clamp(normalize(slice[1], -n-1), -1, n-1)
+
+		for i := upper; lower < i; i += step {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+func (o orExpr) test(e *jsonPathEval, current jsonPathNode) (bool, error) {
+	for _, expr := range o {
+		if ok, err := expr.test(e, current); ok || err != nil {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func (a andExpr) test(e *jsonPathEval, current jsonPathNode) (bool, error) {
+	for _, expr := range a {
+		if ok, err := expr.test(e, current); !ok || err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (n notExpr) test(e *jsonPathEval, current jsonPathNode) (bool, error) {
+	ok, err := n.expr.test(e, current)
+	return !ok, err
+}
+
+func (x existsExpr) test(e *jsonPathEval, current jsonPathNode) (bool, error) {
+	nodes, err := e.query(x.query, current)
+	return len(nodes) > 0, err
+}
+
+func (c compareExpr) test(e *jsonPathEval, current jsonPathNode) (bool, error) {
+	left, err := c.left.value(e, current)
+	if err != nil {
+		return false, err
+	}
+
+	right, err := c.right.value(e, current)
+	if err != nil {
+		return false, err
+	}
+
+	switch c.op {
+	case "==":
+		return equalFilterValues(left, right), nil
+	case "!=":
+		return !equalFilterValues(left, right), nil
+	case "<":
+		return lessFilterValues(left, right), nil
+	case ">":
+		return lessFilterValues(right, left), nil
+	case "<=":
+		return lessFilterValues(left, right) || equalFilterValues(left, right), nil
+	case ">=":
+		return lessFilterValues(right, left) || equalFilterValues(left, right), nil
+	}
+
+	return false, nil
+}
+
+func equalFilterValues(a, b filterValue) bool {
+	if !a.ok || !b.ok {
+		return a.ok == b.ok
+	}
+
+	return reflect.DeepEqual(a.v, b.v)
+}
+
+func lessFilterValues(a, b filterValue) bool {
+	switch av := a.v.(type) {
+	case float64:
+		bv, ok := b.v.(float64)
+		return ok && av < bv
+	case string:
+		bv, ok := b.v.(string)
+		return ok && av < bv
+	}
+
+	return false
+}
+
+func (l literalExpr) value(e *jsonPathEval, current jsonPathNode) (filterValue, error) {
+	return filterValue{v: l.v, ok: true}, nil
+}
+
+func (s singularQueryExpr) value(e *jsonPathEval, current jsonPathNode) (filterValue, error) {
+	nodes, err := e.query(s.query, current)
+	if err != nil || len(nodes) == 0 {
+		return filterValue{}, err
+	}
+
+	return nodeFilterValue(nodes[0].value)
+}
+
+// nodeFilterValue decodes a value of the document, with numbers as float64 so
+// that they compare by value.
+func nodeFilterValue(n *lazyNode) (filterValue, error) {
+	if n == nil {
+		return filterValue{ok: true}, nil
+	}
+
+	buf, err := json.MarshalEscaped(n, false)
+	if err != nil {
+		return filterValue{}, err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return filterValue{}, err
+	}
+
+	return filterValue{v: numbersToFloat(v), ok: true}, nil
+}
+
+func numbersToFloat(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		f, _ := x.Float64()
+		return f
+	case []interface{}:
+		for i := range x {
+			x[i] = numbersToFloat(x[i])
+		}
+	case map[string]interface{}:
+		for k := range x {
+			x[k] = numbersToFloat(x[k])
+		}
+	}
+
+	return v
+}
+
+func (f *functionExpr) value(e *jsonPathEval, current jsonPathNode) (filterValue, error) {
+	arg := f.args[0]
+
+	if arg.query != nil {
+		nodes, err := e.query(arg.query, current)
+		if err != nil {
+			return filterValue{}, err
+		}
+
+		if f.name == "count" {
+			return filterValue{v: float64(len(nodes)), ok: true}, nil
+		}
+
+		// value()
+		if len(nodes) != 1 {
+			return filterValue{}, nil
+		}
+
+		return nodeFilterValue(nodes[0].value)
+	}
+
+	// length()
+	v, err := arg.value.value(e, current)
+	if err != nil {
+		return filterValue{}, err
+	}
+
+	switch x := v.v.(type) {
+	case string:
+		return filterValue{v: float64(utf8.RuneCountInString(x)), ok: true}, nil
+	case []interface{}:
+		return filterValue{v: float64(len(x)), ok: true}, nil
+	case map[string]interface{}:
+		return filterValue{v: float64(len(x)), ok: true}, nil
+	}
+
+	return filterValue{}, nil
+}
+
+func (f *functionExpr) test(e *jsonPathEval, current jsonPathNode) (bool, error) {
+	s, err := f.args[0].value.value(e, current)
+	if err != nil {
+		return false, err
+	}
+
+	pattern, err := f.args[1].value.value(e, current)
+	if err != nil {
+		return false, err
+	}
+
+	str, ok := s.v.(string)
+	if !ok {
+		return false, nil
+	}
+
+	expr, ok := pattern.v.(string)
+	if !ok {
+		return false, nil
+	}
+
+	re, err := compileIRegexp(expr, f.name == "match")
+	if err != nil {
+		// An invalid pattern is not an error, but never matches.
+		return false, nil
+	}
+
+	return re.MatchString(str), nil
+}
+
+// compileIRegexp compiles an RFC 9485 I-Regexp, which is a subset of the
+// syntax of regexp but for "." not matching "\r" either. A full match is
+// anchored at both ends.
+func compileIRegexp(expr string, full bool) (*regexp.Regexp, error) {
+	var sb strings.Builder
+
+	inClass := false
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+
+		switch {
+		case c == '\\' && i+1 < len(expr):
+			sb.WriteByte(c)
+			i++
+			c = expr[i]
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '.' && !inClass:
+			sb.WriteString(`[^\n\r]`)
+			continue
+		}
+
+		sb.WriteByte(c)
+	}
+
+	if full {
+		return regexp.Compile(`\A(?:` + sb.String() + `)\z`)
+	}
+
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,320 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// The example document of RFC 9535.
+var jsonPathDoc = `{
+  "store": {
+    "book": [
+      {"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+      {"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+      {"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+      {"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+    ],
+    "bicycle": {"color": "red", "price": 399}
+  }
+}`
+
+func jsonPathMatches(t *testing.T, doc, query string) ([]string, error) {
+	t.Helper()
+
+	q, err := parseJSONPath(query)
+	if err != nil {
+		return nil, err
+	}
+
+	options := NewApplyOptions()
+
+	pd, err := newContainer([]byte(doc), options)
+	if err != nil {
+		t.Fatalf("Unable to decode %s: %s", doc, err)
+	}
+
+	root := &lazyNode{which: eDoc}
+	switch d := pd.(type) {
+	case *partialDoc:
+		root.doc = d
+	case *partialArray:
+		root.ary, root.which = d, eAry
+	}
+
+	e := &jsonPathEval{root: jsonPathNode{value: root}, options: options}
+
+	nodes, err := e.query(q, e.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, n := range nodes {
+		paths = append(paths, NewPointer(n.tokens...).String())
+	}
+
+	return paths, nil
+}
+
+func TestJSONPathQuery(t *testing.T) {
+	cases := []struct {
+		doc, query string
+		paths      []string
+	}{
+		{jsonPathDoc, `$`, []string{""}},
+		{jsonPathDoc, `$.store.book[*].author`, []string{"/store/book/0/author", "/store/book/1/author", "/store/book/2/author", "/store/book/3/author"}},
+		{jsonPathDoc, `$..author`, []string{"/store/book/0/author", "/store/book/1/author", "/store/book/2/author", "/store/book/3/author"}},
+		{jsonPathDoc, `$.store.*`, []string{"/store/book", "/store/bicycle"}},
+		{jsonPathDoc, `$.store..price`, []string{"/store/book/0/price", "/store/book/1/price", "/store/book/2/price", "/store/book/3/price", "/store/bicycle/price"}},
+		{jsonPathDoc, `$..book[2]`, []string{"/store/book/2"}},
+		{jsonPathDoc, `$..book[-1]`, []string{"/store/book/3"}},
+		{jsonPathDoc, `$..book[0,1]`, []string{"/store/book/0", "/store/book/1"}},
+		{jsonPathDoc, `$..book[:2]`, []string{"/store/book/0", "/store/book/1"}},
+		{jsonPathDoc, `$..book[?@.isbn]`, []string{"/store/book/2", "/store/book/3"}},
+		{jsonPathDoc, `$..book[?@.price<10]`, []string{"/store/book/0", "/store/book/2"}},
+		{jsonPathDoc, `$..book[?@.price<10 && @.category=='fiction'].title`, []string{"/store/book/2/title"}},
+		{jsonPathDoc, `$..book[?!(@.price<10)]`, []string{"/store/book/1", "/store/book/3"}},
+		{jsonPathDoc, `$..book[?@.price > $.store.bicycle.price || @.author == "Evelyn Waugh"]`, []string{"/store/book/1"}},
+		{jsonPathDoc, `$["store"]['bicycle']["color"]`, []string{"/store/bicycle/color"}},
+		{jsonPathDoc, `$.store.book[?match(@.author, 'J.*')]`, []string{"/store/book/3"}},
+		{jsonPathDoc, `$.store.book[?search(@.title, 'of')]`, []string{"/store/book/0", "/store/book/1", "/store/book/3"}},
+		{jsonPathDoc, `$.store.book[?length(@.title) == 9]`, []string{"/store/book/2"}},
+		{jsonPathDoc, `$.store[?count(@.*) == 2]`, []string{"/store/bicycle"}},
+		{jsonPathDoc, `$.store.book[?value(@..isbn) == '0-553-21311-3']`, []string{"/store/book/2"}},
+		{jsonPathDoc, `$.store.book[?@.missing == $.missing]`, []string{"/store/book/0", "/store/book/1", "/store/book/2", "/store/book/3"}},
+		{`[0, 1, 2, 3, 4, 5, 6]`, `$[1:5:2]`, []string{"/1", "/3"}},
+		{`[0, 1, 2, 3, 4, 5, 6]`, `$[5:1:-2]`, []string{"/5", "/3"}},
+		{`[0, 1, 2, 3, 4, 5, 6]`, `$[::-3]`, []string{"/6", "/3", "/0"}},
+		{`[0, 1, 2]`, `$[-5:10]`, []string{"/0", "/1", "/2"}},
+		{`[0, 1, 2]`, `$[::0]`, nil},
+		{`[0, 1, 2]`, `$[5]`, nil},
+		{`{"a": null, "b": [null], "c": [{}], "d": {"e": 1}}`, `$[?@ == null]`, []string{"/a"}},
+		{`{"a": null, "b": [null], "c": [{}], "d": {"e": 1}}`, `$[?@.e == 1.0]`, []string{"/d"}},
+		{`{"a": [1, 2], "b": [1, 2.0], "c": [2, 1]}`, `$[?@ == $.a]`, []string{"/a", "/b"}},
+		{`{"a": "b", "c": "d"}`, `$[?@ > 'a' && @ <= 'c']`, []string{"/a"}},
+		{`{"a~/b": 1, "k": 2}`, `$['a~/b']`, []string{"/a~0~1b"}},
+		{`{"é": 1, "😀": 2}`, `$["é", '😀']`, []string{"/é", "/\U0001F600"}},
+		{`{"a": {"a": {"a": 1}}}`, `$..a`, []string{"/a", "/a/a", "/a/a/a"}},
+		{`{"a": "x\ry"}`, `$[?match(@, 'x.y')]`, nil},
+	}
+
+	for _, c := range cases {
+		paths, err := jsonPathMatches(t, c.doc, c.query)
+		if err != nil {
+			t.Errorf("Unable to evaluate %s: %s", c.query, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(paths, c.paths) {
+			t.Errorf("Evaluating %s: expected %q, got %q", c.query, c.paths, paths)
+		}
+	}
+}
+
+func TestJSONPathInvalid(t *testing.T) {
+	for _, query := range []string{
+		``,
+		`store`,
+		`$.`,
+		`$..`,
+		`$ `,
+		`$[01]`,
+		`$[-0]`,
+		`$['a'`,
+		`$['\q']`,
+		`$[?@.a == ]`,
+		`$[?@.* == 1]`,
+		`$[?length(@.a)]`,
+		`$[?match(@.a, 'a') == true]`,
+		`$[?count(1) == 1]`,
+		`$[?foo(@)]`,
+		`$[?1]`,
+		`$[?!@.a == 1]`,
+		`$.a[9007199254740992]`,
+	} {
+		if _, err := parseJSONPath(query); !errors.Is(err, ErrInvalidJSONPath) {
+			t.Errorf("Expected %q to be invalid, got %v", query, err)
+		}
+	}
+}
+
+func TestJSONPathPatch(t *testing.T) {
+	cases := []struct {
+		doc, patch, result string
+	}{
+		{
+			`{"items": [{"enabled": false, "replicas": 1}, {"enabled": true, "replicas": 2}, {"enabled": false, "replicas": 3}]}`,
+			`[{"op": "replace", "path": "$.items[?@.enabled==false].replicas", "value": 0}]`,
+			`{"items": [{"enabled": false, "replicas": 0}, {"enabled": true, "replicas": 2}, {"enabled": false, "replicas": 0}]}`,
+		},
+		{
+			`{"a": [1, 5, 2, 6, 3]}`,
+			`[{"op": "remove", "path": "$.a[?@ > 4]"}]`,
+			`{"a": [1, 2, 3]}`,
+		},
+		{
+			`{"a": [1, 2, 3]}`,
+			`[{"op": "remove", "path": "$.a[0,2,0]"}]`,
+			`{"a": [2]}`,
+		},
+		{
+			`{"items": [{"name": "a"}, {"name": "b", "tag": "x"}, 1]}`,
+			`[{"op": "add", "path": "$.items[*].tag", "value": "y"}]`,
+			`{"items": [{"name": "a", "tag": "y"}, {"name": "b", "tag": "y"}, 1]}`,
+		},
+		{
+			`{"a": [1, 2]}`,
+			`[{"op": "add", "path": "$.a[*]", "value": 0}]`,
+			`{"a": [0, 1, 0, 2]}`,
+		},
+		{
+			`{"a": {"a": {"a": 1}}}`,
+			`[{"op": "replace", "path": "$..a", "value": 2}]`,
+			`{"a": 2}`,
+		},
+		{
+			`{"src": 1, "a": [{}, {}]}`,
+			`[{"op": "copy", "from": "/src", "path": "$.a[*].b"}, {"op": "test", "path": "$.a[*].b", "value": 1}]`,
+			`{"src": 1, "a": [{"b": 1}, {"b": 1}]}`,
+		},
+		{
+			`{"a": [1, 2]}`,
+			`[{"op": "remove", "path": "$.b[*]"}]`,
+			`{"a": [1, 2]}`,
+		},
+		{
+			`{"a": [1, 2]}`,
+			`[{"op": "replace", "path": "$", "value": {"b": 1}}, {"op": "remove", "path": "/b"}]`,
+			`{}`,
+		},
+	}
+
+	options := NewApplyOptions()
+	options.AllowJSONPath = true
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		out, err := p.ApplyWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to apply %s: %s", c.patch, err)
+			continue
+		}
+
+		if !compareJSON(string(out), c.result) {
+			t.Errorf("Applying %s: expected %s, got %s", c.patch, reformatJSON(c.result), reformatJSON(string(out)))
+		}
+
+		expanded, err := p.Expand([]byte(c.doc))
+		if err != nil {
+			t.Errorf("Unable to expand %s: %s", c.patch, err)
+			continue
+		}
+
+		if out, err := expanded.Apply([]byte(c.doc)); err != nil || !compareJSON(string(out), c.result) {
+			t.Errorf("Applying the expansion of %s gave %s: %v", c.patch, out, err)
+		}
+
+		inverse, err := p.InvertWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to invert %s: %s", c.patch, err)
+			continue
+		}
+
+		if back, err := inverse.Apply(out); err != nil || !compareJSON(string(back), c.doc) {
+			t.Errorf("Inverting %s gave %s: %v", c.patch, back, err)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	doc := `{"a": [{"b": 1}, {"b": 2}, {"c": 3}]}`
+
+	p, err := DecodePatch([]byte(`[
+		{"op": "remove", "path": "$.a[?@.b]"},
+		{"op": "add", "path": "$.a[*].d", "value": true},
+		{"op": "test", "path": "/a/0/c", "value": 3}
+	]`))
+	if err != nil {
+		t.Fatalf("Unable to decode patch: %s", err)
+	}
+
+	expanded, err := p.Expand([]byte(doc))
+	if err != nil {
+		t.Fatalf("Unable to expand: %s", err)
+	}
+
+	var paths []string
+	for _, op := range expanded {
+		path, _ := op.Path()
+		paths = append(paths, op.Kind()+" "+path)
+	}
+
+	expected := []string{"remove /a/1", "remove /a/0", "add /a/0/d", "test /a/0/c"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %q, got %q", expected, paths)
+	}
+
+	// Without AllowJSONPath, the path is not a JSONPath expression.
+	if _, err := p.Apply([]byte(doc)); err == nil {
+		t.Errorf("Expected JSONPath operations to be rejected by default")
+	}
+}
+
+func TestJSONPathPatchFailure(t *testing.T) {
+	doc := `{"a": [{"b": 1}, {"b": 2}, {"c": 3}]}`
+
+	p, err := DecodePatch([]byte(`[
+		{"op": "test", "path": "$.a[*].b", "value": 1},
+		{"op": "replace", "path": "$.a[*].b", "value": 0},
+		{"op": "replace", "path": "$.a[0,2]", "value": 0},
+		{"op": "remove", "path": "$.a[?"}
+	]`))
+	if err != nil {
+		t.Fatalf("Unable to decode patch: %s", err)
+	}
+
+	options := NewApplyOptions()
+	options.AllowJSONPath = true
+	options.ContinueOnError = true
+
+	out, results, err := p.ApplyWithResults([]byte(doc), options)
+	if err != nil {
+		t.Fatalf("Unable to apply patch: %s", err)
+	}
+
+	if !compareJSON(string(out), `{"a": [0, {"b": 0}, 0]}`) {
+		t.Errorf("Unexpected document %s", out)
+	}
+
+	var statuses []OperationStatus
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+
+	expected := []OperationStatus{OperationFailed, OperationApplied, OperationApplied, OperationFailed}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected %v, got %v", expected, statuses)
+	}
+
+	if !errors.Is(results[3].Err, ErrInvalidJSONPath) {
+		t.Errorf("Expected ErrInvalidJSONPath, got %v", results[3].Err)
+	}
+
+	// A failing replace leaves every location it matched unchanged.
+	p, _ = DecodePatch([]byte(`[{"op": "replace", "path": "$.a[*]", "value": 0}, {"op": "replace", "path": "$.a[*].b", "value": 5}]`))
+	out, _, _ = p.ApplyWithResults([]byte(doc), options)
+	if !compareJSON(string(out), `{"a": [0, 0, 0]}`) {
+		t.Errorf("Unexpected document %s", out)
+	}
+
+	p, _ = DecodePatch([]byte(`[{"op": "move", "from": "/a/2/c", "path": "$.a[*].d"}]`))
+	out, results, _ = p.ApplyWithResults([]byte(doc), options)
+	if results[0].Status != OperationFailed || !compareJSON(string(out), doc) {
+		t.Errorf("Expected the move to fail without changes, got %s", out)
+	}
+}
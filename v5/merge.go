@@ -6,11 +6,20 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strconv"
 
 	"github.com/linux019/json-patch/v5/internal/json"
 )
 
-func merge(cur, patch *lazyNode, mergeMerge bool, options *ApplyOptions) *lazyNode {
+func merge(cur, patch *lazyNode, path string, mergeMerge bool, options *ApplyOptions) *lazyNode {
+	if !mergeMerge {
+		if keyPath, ok := lookupArrayKey(options.ArrayKeys, path); ok {
+			if merged, ok := mergeKeyedArray(cur, patch, path, keyPath, options); ok {
+				return merged
+			}
+		}
+	}
+
 	curDoc, err := cur.intoDoc(options)
 
 	if err != nil {
@@ -24,12 +33,12 @@ func merge(cur, patch *lazyNode, mergeMerge bool, options *ApplyOptions) *lazyNo
 		return patch
 	}
 
-	mergeDocs(curDoc, patchDoc, mergeMerge, options)
+	mergeDocs(curDoc, patchDoc, path, mergeMerge, options)
 
 	return cur
 }
 
-func mergeDocs(doc, patch *partialDoc, mergeMerge bool, options *ApplyOptions) {
+func mergeDocs(doc, patch *partialDoc, path string, mergeMerge bool, options *ApplyOptions) {
 	for k, v := range patch.obj {
 		if v == nil {
 			if mergeMerge {
@@ -56,12 +65,115 @@ func mergeDocs(doc, patch *partialDoc, mergeMerge bool, options *ApplyOptions) {
 				}
 				_ = doc.set(k, v, options)
 			} else {
-				_ = doc.set(k, merge(cur, v, mergeMerge, options), options)
+				_ = doc.set(k, merge(cur, v, path+"/"+encodePatchKey(k), mergeMerge, options), options)
 			}
 		}
 	}
 }
 
+// mergeKeyedArray merges a keyed array merge patch into the array cur. Each
+// entry of the patch is matched to the element of cur with the same identity
+// at keyPath. An entry with a "$patch" member of "delete" removes the
+// element, any other entry is merged into the element, or appended when no
+// element matches. The elements named by the patch are then laid out in the
+// order of the patch, in the positions they occupy. It reports false when
+// the arrays cannot be merged by identity, so that the patch replaces cur.
+func mergeKeyedArray(cur, patch *lazyNode, path, keyPath string, options *ApplyOptions) (*lazyNode, bool) {
+	if nodeKind(cur) != kindArray || nodeKind(patch) != kindArray {
+		return nil, false
+	}
+
+	curAry, err := cur.intoAry()
+	if err != nil {
+		return nil, false
+	}
+
+	patchAry, err := patch.intoAry()
+	if err != nil {
+		return nil, false
+	}
+
+	curIds, ok := nodeIdentities(curAry.nodes, keyPath, options)
+	if !ok {
+		return nil, false
+	}
+
+	patchIds, ok := nodeIdentities(patchAry.nodes, keyPath, options)
+	if !ok {
+		return nil, false
+	}
+
+	index := make(map[string]int, len(curIds))
+	for i, id := range curIds {
+		index[id] = i
+	}
+
+	nodes := make([]*lazyNode, len(curAry.nodes))
+	copy(nodes, curAry.nodes)
+
+	deleted := make([]bool, len(nodes))
+	named := make([]bool, len(nodes))
+	var order []*lazyNode
+	var added []*lazyNode
+
+	for j, entry := range patchAry.nodes {
+		entryDoc, err := entry.intoDoc(options)
+		if err != nil {
+			return nil, false
+		}
+
+		i, found := index[patchIds[j]]
+
+		if directive, ok := entryDoc.obj[mergeDirective]; ok {
+			var kind string
+			if directive == nil || unmarshal(*directive.raw, &kind) != nil || kind != "delete" {
+				return nil, false
+			}
+
+			if found {
+				deleted[i] = true
+			}
+			continue
+		}
+
+		if !found {
+			pruneNulls(entry, options)
+			added = append(added, entry)
+			order = append(order, entry)
+			continue
+		}
+
+		nodes[i] = merge(nodes[i], entry, path+"/"+strconv.Itoa(i), false, options)
+		named[i] = true
+		order = append(order, nodes[i])
+	}
+
+	result := make([]*lazyNode, 0, len(nodes)+len(added))
+	slots := []int{}
+
+	for i, n := range nodes {
+		if deleted[i] {
+			continue
+		}
+
+		if named[i] {
+			slots = append(slots, len(result))
+		}
+		result = append(result, n)
+	}
+
+	for _, n := range added {
+		slots = append(slots, len(result))
+		result = append(result, n)
+	}
+
+	for k, slot := range slots {
+		result[slot] = order[k]
+	}
+
+	return &lazyNode{ary: &partialArray{nodes: result}, which: eAry}, true
+}
+
 func pruneNulls(n *lazyNode, options *ApplyOptions) {
 	sub, err := n.intoDoc(options)
 
@@ -190,7 +302,7 @@ func doMergePatch(docData, patchData []byte, mergeMerge bool, options *ApplyOpti
 			return out, nil
 		}
 	} else {
-		mergeDocs(doc, patch, mergeMerge, options)
+		mergeDocs(doc, patch, "", mergeMerge, options)
 	}
 
 	return json.Marshal(doc)
@@ -232,17 +344,33 @@ func resemblesJSONArray(input []byte) bool {
 // JSON documents.
 // The merge patch returned follows the specification defined at http://tools.ietf.org/html/draft-ietf-appsawg-json-merge-patch-07
 func CreateMergePatch(originalJSON, modifiedJSON []byte) ([]byte, error) {
+	return CreateMergePatchWithOptions(originalJSON, modifiedJSON, NewDiffOptions())
+}
+
+// CreateMergePatchWithOptions is like CreateMergePatch, but arrays listed in
+// DiffOptions.ArrayKeys are diffed element by element. Such an array is
+// represented in the merge patch by an array holding one entry per changed,
+// added or deleted element, each entry carrying the identity key of its
+// element. A deleted element is marked with a "$patch" member of "delete".
+// When the order of the elements changed, every element is listed in its new
+// order. The resulting patch must be applied with MergePatchWithOptions using
+// the same ArrayKeys.
+func CreateMergePatchWithOptions(originalJSON, modifiedJSON []byte, options *DiffOptions) ([]byte, error) {
+	if !json.Valid(originalJSON) || !json.Valid(modifiedJSON) {
+		return nil, ErrBadJSONDoc
+	}
+
 	originalResemblesArray := resemblesJSONArray(originalJSON)
 	modifiedResemblesArray := resemblesJSONArray(modifiedJSON)
 
 	// Do both byte-slices seem like JSON arrays?
 	if originalResemblesArray && modifiedResemblesArray {
-		return createArrayMergePatch(originalJSON, modifiedJSON)
+		return createArrayMergePatch(originalJSON, modifiedJSON, options)
 	}
 
 	// Are both byte-slices are not arrays? Then they are likely JSON objects...
 	if !originalResemblesArray && !modifiedResemblesArray {
-		return createObjectMergePatch(originalJSON, modifiedJSON)
+		return createObjectMergePatch(originalJSON, modifiedJSON, options)
 	}
 
 	// None of the above? Then return an error because of mismatched types.
@@ -251,7 +379,7 @@ func CreateMergePatch(originalJSON, modifiedJSON []byte) ([]byte, error) {
 
 // createObjectMergePatch will return a merge-patch document capable of
 // converting the original document to the modified document.
-func createObjectMergePatch(originalJSON, modifiedJSON []byte) ([]byte, error) {
+func createObjectMergePatch(originalJSON, modifiedJSON []byte, options *DiffOptions) ([]byte, error) {
 	originalDoc := map[string]interface{}{}
 	modifiedDoc := map[string]interface{}{}
 
@@ -265,7 +393,14 @@ func createObjectMergePatch(originalJSON, modifiedJSON []byte) ([]byte, error) {
 		return nil, ErrBadJSONDoc
 	}
 
-	dest, err := getDiff(originalDoc, modifiedDoc)
+	// A null document has no members to diff. Merging a patch that is not
+	// an object replaces the whole document, as does merging any patch into
+	// null, so the modified document is the patch.
+	if originalDoc == nil || modifiedDoc == nil {
+		return json.Marshal(modifiedDoc)
+	}
+
+	dest, err := getDiff(originalDoc, modifiedDoc, "", options.ArrayKeys)
 	if err != nil {
 		return nil, err
 	}
@@ -281,7 +416,7 @@ func unmarshal(data []byte, into interface{}) error {
 // of converting the original document to the modified document for each
 // pair of JSON documents provided in the arrays.
 // Arrays of mismatched sizes will result in an error.
-func createArrayMergePatch(originalJSON, modifiedJSON []byte) ([]byte, error) {
+func createArrayMergePatch(originalJSON, modifiedJSON []byte, options *DiffOptions) ([]byte, error) {
 	originalDocs := []json.RawMessage{}
 	modifiedDocs := []json.RawMessage{}
 
@@ -305,7 +440,7 @@ func createArrayMergePatch(originalJSON, modifiedJSON []byte) ([]byte, error) {
 		original := originalDocs[i]
 		modified := modifiedDocs[i]
 
-		patch, err := createObjectMergePatch(original, modified)
+		patch, err := createObjectMergePatch(original, modified, options)
 		if err != nil {
 			return nil, err
 		}
@@ -388,7 +523,8 @@ func matchesValue(av, bv interface{}) bool {
 }
 
 // getDiff returns the (recursive) difference between a and b as a map[string]interface{}.
-func getDiff(a, b map[string]interface{}) (map[string]interface{}, error) {
+// The path of a within the document is used to find arrays listed in arrayKeys.
+func getDiff(a, b map[string]interface{}, path string, arrayKeys map[string]string) (map[string]interface{}, error) {
 	into := map[string]interface{}{}
 	for key, bv := range b {
 		av, ok := a[key]
@@ -407,7 +543,7 @@ func getDiff(a, b map[string]interface{}) (map[string]interface{}, error) {
 		case map[string]interface{}:
 			bt := bv.(map[string]interface{})
 			dst := make(map[string]interface{}, len(bt))
-			dst, err := getDiff(at, bt)
+			dst, err := getDiff(at, bt, path+"/"+encodePatchKey(key), arrayKeys)
 			if err != nil {
 				return nil, err
 			}
@@ -420,9 +556,23 @@ func getDiff(a, b map[string]interface{}) (map[string]interface{}, error) {
 			}
 		case []interface{}:
 			bt := bv.([]interface{})
-			if !matchesArray(at, bt) {
-				into[key] = bv
+			if matchesArray(at, bt) {
+				continue
 			}
+			childPath := path + "/" + encodePatchKey(key)
+			if keyPath, ok := lookupArrayKey(arrayKeys, childPath); ok {
+				dst, ok, err := getKeyedArrayDiff(at, bt, childPath, keyPath, arrayKeys)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					if dst != nil {
+						into[key] = dst
+					}
+					continue
+				}
+			}
+			into[key] = bv
 		case nil:
 			switch bv.(type) {
 			case nil:
@@ -431,7 +581,7 @@ func getDiff(a, b map[string]interface{}) (map[string]interface{}, error) {
 				into[key] = bv
 			}
 		default:
-			panic(fmt.Sprintf("Unknown type:%T in key %s", av, key))
+			return nil, fmt.Errorf("unknown type: %T in key %s: %w", av, key, ErrBadJSONDoc)
 		}
 	}
 	// Now add all deleted values as nil
@@ -443,3 +593,111 @@ func getDiff(a, b map[string]interface{}) (map[string]interface{}, error) {
 	}
 	return into, nil
 }
+
+// getKeyedArrayDiff returns the keyed array merge patch, as described in
+// CreateMergePatchWithOptions, that turns a into b, or nil if nothing
+// changed. It reports false when the elements cannot be matched by their
+// identity at keyPath.
+func getKeyedArrayDiff(a, b []interface{}, path, keyPath string, arrayKeys map[string]string) ([]interface{}, bool, error) {
+	aIds, ok := valueIdentities(a, keyPath)
+	if !ok {
+		return nil, false, nil
+	}
+
+	bIds, ok := valueIdentities(b, keyPath)
+	if !ok {
+		return nil, false, nil
+	}
+
+	index := make(map[string]int, len(aIds))
+	for i, id := range aIds {
+		index[id] = i
+	}
+
+	present := make(map[string]bool, len(bIds))
+	named := make(map[string]bool, len(bIds))
+	entries := []interface{}{}
+	// all lists an entry for every element of b, which is needed when the
+	// order of the elements changed.
+	all := make([]interface{}, 0, len(b))
+
+	for j, bv := range b {
+		present[bIds[j]] = true
+
+		i, found := index[bIds[j]]
+		if !found {
+			named[bIds[j]] = true
+			entries = append(entries, bv)
+			all = append(all, bv)
+			continue
+		}
+
+		dst, err := getDiff(a[i].(map[string]interface{}), bv.(map[string]interface{}), path+"/"+strconv.Itoa(i), arrayKeys)
+		if err != nil {
+			return nil, false, err
+		}
+
+		changed := len(dst) > 0
+
+		id, _ := valueAtKeyPath(bv, keyPath)
+		setValueAtKeyPath(dst, keyPath, id)
+
+		all = append(all, dst)
+		if changed {
+			named[bIds[j]] = true
+			entries = append(entries, dst)
+		}
+	}
+
+	// Lay out the elements the way MergePatchWithOptions does: the elements
+	// named by the patch take the positions of named elements, and of the
+	// appended ones, in the order of the patch.
+	order := make([]string, 0, len(b))
+	for _, id := range aIds {
+		if present[id] {
+			order = append(order, id)
+		}
+	}
+	for _, id := range bIds {
+		if _, found := index[id]; !found {
+			order = append(order, id)
+		}
+	}
+
+	next := 0
+	for i, id := range order {
+		if !named[id] {
+			continue
+		}
+
+		for !named[bIds[next]] {
+			next++
+		}
+		order[i] = bIds[next]
+		next++
+	}
+
+	for i, id := range order {
+		if id != bIds[i] {
+			entries = all
+			break
+		}
+	}
+
+	for i, av := range a {
+		if present[aIds[i]] {
+			continue
+		}
+
+		id, _ := valueAtKeyPath(av, keyPath)
+		entry := map[string]interface{}{mergeDirective: "delete"}
+		setValueAtKeyPath(entry, keyPath, id)
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil, true, nil
+	}
+
+	return entries, true, nil
+}
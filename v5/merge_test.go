@@ -333,6 +333,43 @@ func TestCreateMergePatchNil(t *testing.T) {
 	}
 }
 
+func TestCreateMergePatchNullDocument(t *testing.T) {
+	cases := []struct {
+		original, modified, patch string
+	}{
+		{`null`, `{"a": 1}`, `{"a": 1}`},
+		{`{"a": 1}`, `null`, `null`},
+		{`null`, `null`, `null`},
+	}
+
+	for _, c := range cases {
+		res, err := CreateMergePatch([]byte(c.original), []byte(c.modified))
+		if err != nil {
+			t.Errorf("Unexpected error diffing %s and %s: %s", c.original, c.modified, err)
+			continue
+		}
+
+		if !compareJSON(c.patch, string(res)) {
+			t.Errorf("Diffing %s and %s: expected %s, got %s", c.original, c.modified, c.patch, res)
+		}
+
+		// MergePatch does not accept null as the document to patch.
+		if c.original == `null` {
+			continue
+		}
+
+		out, err := MergePatch([]byte(c.original), res)
+		if err != nil {
+			t.Errorf("Unable to merge %s into %s: %s", res, c.original, err)
+			continue
+		}
+
+		if !compareJSON(c.modified, string(out)) {
+			t.Errorf("Merging %s into %s: expected %s, got %s", res, c.original, c.modified, out)
+		}
+	}
+}
+
 func TestCreateMergePatchObjArray(t *testing.T) {
 	doc := `{ "array": [ {"a": {"b": 2}}, {"a": {"b": 3}} ]}`
 	exp := `{}`
@@ -723,3 +760,112 @@ func TestMergePatchWithOptions(t *testing.T) {
 		t.Fatalf("testMergePatchWithOptions fails for %s", string(modified))
 	}
 }
+
+func TestCreateMergePatchWithArrayKeys(t *testing.T) {
+	cases := []struct {
+		name, original, modified, patch string
+	}{
+		{
+			"change element",
+			`{"containers": [{"name": "a", "image": "x:1"}, {"name": "b", "image": "y:1"}]}`,
+			`{"containers": [{"name": "a", "image": "x:1"}, {"name": "b", "image": "y:2"}]}`,
+			`{"containers": [{"name": "b", "image": "y:2"}]}`,
+		},
+		{
+			"add and delete elements",
+			`{"containers": [{"name": "a"}, {"name": "b"}]}`,
+			`{"containers": [{"name": "b"}, {"name": "c", "port": 80}]}`,
+			`{"containers": [{"name": "c", "port": 80}, {"name": "a", "$patch": "delete"}]}`,
+		},
+		{
+			"reorder elements",
+			`{"containers": [{"name": "a"}, {"name": "b", "port": 1}]}`,
+			`{"containers": [{"name": "b", "port": 2}, {"name": "a"}]}`,
+			`{"containers": [{"name": "b", "port": 2}, {"name": "a"}]}`,
+		},
+		{
+			"remove field of element",
+			`{"containers": [{"name": "a", "port": 1}]}`,
+			`{"containers": [{"name": "a"}]}`,
+			`{"containers": [{"name": "a", "port": null}]}`,
+		},
+		{
+			"nested keyed arrays",
+			`{"pods": [{"id": 1, "containers": [{"name": "a", "port": 1}, {"name": "b"}]}]}`,
+			`{"pods": [{"id": 1, "containers": [{"name": "a", "port": 2}, {"name": "b"}]}]}`,
+			`{"pods": [{"id": 1, "containers": [{"name": "a", "port": 2}]}]}`,
+		},
+		{
+			"unkeyed elements",
+			`{"containers": [{"name": "a"}, {"image": "x"}]}`,
+			`{"containers": [{"name": "a"}, {"image": "y"}]}`,
+			`{"containers": [{"name": "a"}, {"image": "y"}]}`,
+		},
+		{
+			"unchanged",
+			`{"containers": [{"name": "a"}], "x": 1}`,
+			`{"containers": [{"name": "a"}], "x": 2}`,
+			`{"x": 2}`,
+		},
+	}
+
+	diffOptions := NewDiffOptions()
+	diffOptions.ArrayKeys = map[string]string{
+		"/containers":        "/name",
+		"/pods":              "/id",
+		"/pods/*/containers": "/name",
+	}
+
+	applyOptions := NewApplyOptions()
+	applyOptions.ArrayKeys = diffOptions.ArrayKeys
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			patch, err := CreateMergePatchWithOptions([]byte(c.original), []byte(c.modified), diffOptions)
+			if err != nil {
+				t.Fatalf("Unable to create merge patch: %s", err)
+			}
+
+			if !compareJSON(string(patch), c.patch) {
+				t.Errorf("Unexpected merge patch. Expected:\n%s\n\nActual:\n%s", c.patch, patch)
+			}
+
+			out, err := MergePatchWithOptions([]byte(c.original), patch, applyOptions)
+			if err != nil {
+				t.Fatalf("Unable to apply merge patch: %s", err)
+			}
+
+			if !compareJSON(string(out), c.modified) {
+				t.Errorf("Merge patch did not produce the modified document. Expected:\n%s\n\nActual:\n%s", c.modified, out)
+			}
+		})
+	}
+}
+
+func TestMergePatchWithArrayKeysKeepsOtherElements(t *testing.T) {
+	doc := `{"containers": [{"name": "a", "image": "x:1"}, {"name": "b"}, {"name": "c"}]}`
+	pat := `{"containers": [{"name": "c", "image": "z:1"}, {"name": "a", "image": null}, {"name": "d"}, {"name": "b", "$patch": "delete"}]}`
+	exp := `{"containers": [{"name": "c", "image": "z:1"}, {"name": "a"}, {"name": "d"}]}`
+
+	options := NewApplyOptions()
+	options.ArrayKeys = map[string]string{"/containers": "/name"}
+
+	out, err := MergePatchWithOptions([]byte(doc), []byte(pat), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !compareJSON(string(out), exp) {
+		t.Fatalf("Unexpected merge result. Expected:\n%s\n\nActual:\n%s", exp, out)
+	}
+
+	// Without keys the array is replaced as a whole.
+	out, err = MergePatch([]byte(doc), []byte(pat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !compareJSON(string(out), `{"containers": [{"name": "c", "image": "z:1"}, {"name": "a"}, {"name": "d"}, {"name": "b", "$patch": "delete"}]}`) {
+		t.Fatalf("Unexpected merge result without keys: %s", out)
+	}
+}
@@ -40,6 +40,8 @@ var (
 
 	ErrExpectedObject = errors.New("invalid value, expected object")
 
+	ErrCopyConflict = errors.New("copied value changed concurrently")
+
 	rawJSONArray  = []byte("[]")
 	rawJSONObject = []byte("{}")
 	rawJSONNull   = []byte("null")
@@ -94,6 +96,67 @@ type ApplyOptions struct {
 	// EnsurePathExistsOnAdd instructs json-patch to recursively create the missing parts of path on "add" operation.
 	// Default to false.
 	EnsurePathExistsOnAdd bool
+	// ContinueOnError makes ApplyWithResults carry on with the next
+	// operation when one fails, instead of giving up on the document.
+	// Default to false.
+	ContinueOnError bool
+	// AllowRelativeFrom lets the "from" field of "move" and "copy"
+	// operations hold a Relative JSON Pointer, such as "1/a", which is
+	// resolved against the operation's "path".
+	// Default to false.
+	AllowRelativeFrom bool
+	// AllowJSONPath lets the "path" of operations be an RFC 9535 JSONPath
+	// expression starting with "$", such as "$.items[*].replicas", which is
+	// applied to every location it matches. See Patch.ExpandWithOptions.
+	// Default to false.
+	AllowJSONPath bool
+	// AllowWildcards lets a "*" segment of the "path" of operations, such as
+	// "/spec/containers/*/image", match every member of an object or element
+	// of an array, so that the operation applies to each of them. A member
+	// named "*" cannot be referred to when it is set.
+	// Default to false.
+	AllowWildcards bool
+	// RequireMatch makes an operation whose path is a JSONPath expression or
+	// holds a wildcard fail with ErrMissing when it matches no location,
+	// rather than do nothing.
+	// Default to false.
+	RequireMatch bool
+	// CustomOperations maps operation kinds beyond those of RFC 6902 to the
+	// handlers applying them. See RegisterOperation.
+	// Default to nil.
+	CustomOperations map[string]OperationHandler
+	// ExtendedTests gives a meaning to the following members of "test"
+	// operations, which then pass if all the conditions they hold are met:
+	// "exists" (a boolean), "type" (one of "string", "number", "integer",
+	// "object", "array", "null" and "boolean"), "pattern" (a regular
+	// expression the string must match), "contains" (a value the array
+	// holds), and "minimum", "maximum", "exclusiveMinimum" and
+	// "exclusiveMaximum" (bounds of the number). "not": true negates the
+	// test.
+	// Default to false.
+	ExtendedTests bool
+	// ConditionalOperations lets operations hold an "if" member, such as
+	// {"path": "/version", "value": 1}, or an array of them: "test"
+	// operations without "op", which must all pass against the current
+	// document for the operation to apply. Otherwise the operation is
+	// skipped rather than failing the patch. A test path not starting with
+	// "/" is a Relative JSON Pointer resolved against the operation's path.
+	// Default to false.
+	ConditionalOperations bool
+	// Strict applies patches as RFC 6902 specifies, whatever the other
+	// options say. Negative array indices, indices with a sign or leading
+	// zeros, operations with a duplicate member, and "test" operations
+	// without a "value" or whose location is missing are rejected. The
+	// options extending the RFC are ignored. An empty reference token, as
+	// in "/", names the member "" rather than its parent. Members an
+	// operation does not define are still ignored, as the RFC requires.
+	// Default to false.
+	Strict bool
+	// ArrayKeys instructs MergePatchWithOptions to merge arrays of objects
+	// element by element, matching elements by identity. It uses the same
+	// format as DiffOptions.ArrayKeys.
+	// Default to nil.
+	ArrayKeys map[string]string
 
 	EscapeHTML bool
 }
@@ -225,13 +288,23 @@ func deepCopy(src *lazyNode, options *ApplyOptions) (*lazyNode, int, error) {
 	return newLazyNode(newRawMessage(a)), sz, nil
 }
 
+// nextByte returns the first byte of the raw value that is not a space, or 0
+// if there is none.
 func (n *lazyNode) nextByte() byte {
+	if n.raw == nil {
+		return 0
+	}
+
 	s := []byte(*n.raw)
 
-	for unicode.IsSpace(rune(s[0])) {
+	for len(s) > 0 && unicode.IsSpace(rune(s[0])) {
 		s = s[1:]
 	}
 
+	if len(s) == 0 {
+		return 0
+	}
+
 	return s[0]
 }
 
@@ -345,6 +418,13 @@ func (n *lazyNode) isNull() bool {
 }
 
 func (n *lazyNode) equal(o *lazyNode) bool {
+	// Nulls within objects and arrays, and missing values, are nil nodes.
+	// Other nulls are compared here too, as tryAry would turn them into
+	// arrays without elements, which cannot be marshalled.
+	if nodeKind(n) == kindNull || nodeKind(o) == kindNull {
+		return nodeKind(n) == kindNull && nodeKind(o) == kindNull
+	}
+
 	if n.which == eRaw {
 		if !n.tryDoc() && !n.tryAry() {
 			if o.which != eRaw {
@@ -354,7 +434,7 @@ func (n *lazyNode) equal(o *lazyNode) bool {
 			nc := n.compact()
 			oc := o.compact()
 
-			if nc[0] == '"' && oc[0] == '"' {
+			if len(nc) > 0 && len(oc) > 0 && nc[0] == '"' && oc[0] == '"' {
 				// ok, 2 strings
 
 				var ns, os string
@@ -600,7 +680,8 @@ func (d *partialDoc) add(key string, val *lazyNode, options *ApplyOptions) error
 }
 
 func (d *partialDoc) get(key string, options *ApplyOptions) (*lazyNode, error) {
-	if key == "" {
+	// In strict mode, "" is the name of a member, as in the pointer "/".
+	if key == "" && !options.Strict {
 		return d.self, nil
 	}
 
@@ -642,7 +723,7 @@ func (d *partialDoc) remove(key string, options *ApplyOptions) error {
 // set should only be used to implement the "replace" operation, so "key" must
 // be an already existing index in "d".
 func (d *partialArray) set(key string, val *lazyNode, options *ApplyOptions) error {
-	idx, err := strconv.Atoi(key)
+	idx, err := parseIndex(key, options)
 	if err != nil {
 		return err
 	}
@@ -657,6 +738,10 @@ func (d *partialArray) set(key string, val *lazyNode, options *ApplyOptions) err
 		idx += len(d.nodes)
 	}
 
+	if idx >= len(d.nodes) {
+		return fmt.Errorf("Unable to access invalid index: %d: %w", idx, ErrInvalidIndex)
+	}
+
 	d.nodes[idx] = val
 	return nil
 }
@@ -667,7 +752,7 @@ func (d *partialArray) add(key string, val *lazyNode, options *ApplyOptions) err
 		return nil
 	}
 
-	idx, err := strconv.Atoi(key)
+	idx, err := parseIndex(key, options)
 	if err != nil {
 		return fmt.Errorf("value was not a proper array index: '%s': %w", key, err)
 	}
@@ -701,11 +786,11 @@ func (d *partialArray) add(key string, val *lazyNode, options *ApplyOptions) err
 }
 
 func (d *partialArray) get(key string, options *ApplyOptions) (*lazyNode, error) {
-	if key == "" {
+	if key == "" && !options.Strict {
 		return d.self, nil
 	}
 
-	idx, err := strconv.Atoi(key)
+	idx, err := parseIndex(key, options)
 
 	if err != nil {
 		return nil, err
@@ -729,7 +814,7 @@ func (d *partialArray) get(key string, options *ApplyOptions) (*lazyNode, error)
 }
 
 func (d *partialArray) remove(key string, options *ApplyOptions) error {
-	idx, err := strconv.Atoi(key)
+	idx, err := parseIndex(key, options)
 	if err != nil {
 		return err
 	}
@@ -798,8 +883,12 @@ func (p Patch) add(doc *container, op Operation, options *ApplyOptions) error {
 		return nil
 	}
 
+	// Containers created along the path are removed again if the value
+	// cannot be added, so that a failed add leaves the document as it was.
+	undo := func() {}
+
 	if options.EnsurePathExistsOnAdd {
-		err = ensurePathExists(doc, path, options)
+		undo, err = ensurePathExists(doc, path, options)
 
 		if err != nil {
 			return err
@@ -809,29 +898,69 @@ func (p Patch) add(doc *container, op Operation, options *ApplyOptions) error {
 	con, key := findObject(doc, path, options)
 
 	if con == nil {
+		undo()
 		return fmt.Errorf("add operation does not apply: doc is missing path: \"%s\": %w", path, ErrMissing)
 	}
 
 	err = con.add(key, op.value(), options)
 	if err != nil {
+		undo()
 		return fmt.Errorf("error in add for path: '%s': %w", path, err)
 	}
 
 	return nil
 }
 
+// restorer returns a function that sets the members or elements of con back
+// to what they are now. The values themselves are not copied, so it only
+// undoes adding values to con and removing them from it.
+func restorer(con container) func() {
+	switch c := con.(type) {
+	case *partialDoc:
+		keys := make([]string, len(c.keys))
+		copy(keys, c.keys)
+
+		var obj map[string]*lazyNode
+		if c.obj != nil {
+			obj = make(map[string]*lazyNode, len(c.obj))
+			for k, v := range c.obj {
+				obj[k] = v
+			}
+		}
+
+		return func() {
+			c.keys, c.obj = keys, obj
+		}
+	case *partialArray:
+		// An empty array must stay empty rather than become null.
+		nodes := make([]*lazyNode, len(c.nodes))
+		copy(nodes, c.nodes)
+
+		return func() {
+			c.nodes = nodes
+		}
+	}
+
+	return func() {}
+}
+
 // Given a document and a path to a key, walk the path and create all missing elements
-// creating objects and arrays as needed.
-func ensurePathExists(pd *container, path string, options *ApplyOptions) error {
+// creating objects and arrays as needed. The returned function removes them again.
+func ensurePathExists(pd *container, path string, options *ApplyOptions) (func(), error) {
 	doc := *pd
 
 	var err error
 	var arrIndex int
 
+	// Everything is created within the first container found to lack a
+	// part of the path, so restoring it removes all of it.
+	undo := func() {}
+	created := false
+
 	split := strings.Split(path, "/")
 
 	if len(split) < 2 {
-		return nil
+		return undo, nil
 	}
 
 	parts := split[1:]
@@ -841,12 +970,16 @@ func ensurePathExists(pd *container, path string, options *ApplyOptions) error {
 		// Have we reached the key part of the path?
 		// If yes, we're done.
 		if pi == len(parts)-1 {
-			return nil
+			return undo, nil
 		}
 
 		target, ok := doc.get(decodePatchKey(part), options)
 
 		if target == nil || ok != nil {
+			if !created {
+				undo = restorer(doc)
+				created = true
+			}
 
 			// If the current container is an array which has fewer elements than our target index,
 			// pad the current container with nulls.
@@ -867,11 +1000,13 @@ func ensurePathExists(pd *container, path string, options *ApplyOptions) error {
 				if arrIndex < 0 {
 
 					if !options.SupportNegativeIndices {
-						return fmt.Errorf("Unable to ensure path for invalid index: %d: %w", arrIndex, ErrInvalidIndex)
+						undo()
+						return nil, fmt.Errorf("Unable to ensure path for invalid index: %d: %w", arrIndex, ErrInvalidIndex)
 					}
 
 					if arrIndex < -1 {
-						return fmt.Errorf("Unable to ensure path for negative index other than -1: %d: %w", arrIndex, ErrInvalidIndex)
+						undo()
+						return nil, fmt.Errorf("Unable to ensure path for negative index other than -1: %d: %w", arrIndex, ErrInvalidIndex)
 					}
 
 					arrIndex = 0
@@ -891,7 +1026,8 @@ func ensurePathExists(pd *container, path string, options *ApplyOptions) error {
 				doc.add(part, newNode, options)
 				doc, err = newNode.intoDoc(options)
 				if err != nil {
-					return err
+					undo()
+					return nil, err
 				}
 			}
 		} else {
@@ -899,23 +1035,25 @@ func ensurePathExists(pd *container, path string, options *ApplyOptions) error {
 				doc, err = target.intoAry()
 
 				if err != nil {
-					return err
+					undo()
+					return nil, err
 				}
 			} else {
 				doc, err = target.intoDoc(options)
 
 				if err != nil {
-					return err
+					undo()
+					return nil, err
 				}
 			}
 		}
 	}
 
-	return nil
+	return undo, nil
 }
 
-func validateOperation(op Operation) error {
-	switch op.Kind() {
+func validateOperation(op Operation, options *ApplyOptions) error {
+	switch kind := op.Kind(); kind {
 	case "add", "replace":
 		if _, err := op.ValueInterface(); err != nil {
 			return fmt.Errorf("failed to decode 'value': %w", err)
@@ -924,21 +1062,33 @@ func validateOperation(op Operation) error {
 		if _, err := op.From(); err != nil {
 			return fmt.Errorf("failed to decode 'from': %w", err)
 		}
-	case "remove", "test":
+	case "test":
+		if _, ok := op["value"]; !ok && options.Strict {
+			return fmt.Errorf("missing 'value': %w", ErrMissing)
+		}
+	case "remove":
 	default:
-		return fmt.Errorf("unsupported operation")
+		if _, ok := options.CustomOperations[kind]; !ok {
+			return fmt.Errorf("unsupported operation")
+		}
 	}
 
 	if _, err := op.Path(); err != nil {
 		return fmt.Errorf("failed to decode 'path': %w", err)
 	}
 
+	if options.ConditionalOperations {
+		if _, err := op.conditions(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func validatePatch(p Patch) error {
+func validatePatch(p Patch, options *ApplyOptions) error {
 	for _, op := range p {
-		if err := validateOperation(op); err != nil {
+		if err := validateOperation(op, options); err != nil {
 			opData, infoErr := json.Marshal(op)
 			if infoErr != nil {
 				return fmt.Errorf("invalid operation: %w", err)
@@ -1018,14 +1168,14 @@ func (p Patch) replace(doc *container, op Operation, options *ApplyOptions) erro
 
 	err = con.set(key, op.value(), options)
 	if err != nil {
-		return fmt.Errorf("error in remove for path: '%s': %w", path, err)
+		return fmt.Errorf("error in replace for path: '%s': %w", path, err)
 	}
 
 	return nil
 }
 
 func (p Patch) move(doc *container, op Operation, options *ApplyOptions) error {
-	from, err := op.From()
+	from, err := op.resolveFrom(options)
 	if err != nil {
 		return fmt.Errorf("move operation failed to decode from: %w", err)
 	}
@@ -1045,6 +1195,10 @@ func (p Patch) move(doc *container, op Operation, options *ApplyOptions) error {
 		return fmt.Errorf("error in move for path: '%s': %w", key, err)
 	}
 
+	// Put the value back in its place when the destination is unusable, so
+	// that a failed move leaves the document as it was.
+	undo := restorer(con)
+
 	err = con.remove(key, options)
 	if err != nil {
 		return fmt.Errorf("error in move for path: '%s': %w", key, err)
@@ -1052,42 +1206,58 @@ func (p Patch) move(doc *container, op Operation, options *ApplyOptions) error {
 
 	path, err := op.Path()
 	if err != nil {
+		undo()
 		return fmt.Errorf("move operation failed to decode path: %w", err)
 	}
 
 	con, key = findObject(doc, path, options)
 
 	if con == nil {
+		undo()
 		return fmt.Errorf("move operation does not apply: doc is missing destination path: %s: %w", path, ErrMissing)
 	}
 
 	err = con.add(key, val, options)
 	if err != nil {
+		undo()
 		return fmt.Errorf("error in move for path: '%s': %w", path, err)
 	}
 
 	return nil
 }
 
+// rootNode returns the document doc holds as a node.
+func rootNode(doc *container) *lazyNode {
+	var self lazyNode
+
+	switch sv := (*doc).(type) {
+	case *partialDoc:
+		self.doc = sv
+		self.which = eDoc
+	case *partialArray:
+		self.ary = sv
+		self.which = eAry
+	}
+
+	return &self
+}
+
 func (p Patch) test(doc *container, op Operation, options *ApplyOptions) error {
+	if isExtendedTest(op, options) {
+		return p.extendedTest(doc, op, options)
+	}
+
 	path, err := op.Path()
 	if err != nil {
 		return fmt.Errorf("test operation failed to decode path: %w", err)
 	}
 
-	if path == "" {
-		var self lazyNode
-
-		switch sv := (*doc).(type) {
-		case *partialDoc:
-			self.doc = sv
-			self.which = eDoc
-		case *partialArray:
-			self.ary = sv
-			self.which = eAry
-		}
+	if _, ok := op["value"]; !ok && options.Strict {
+		return fmt.Errorf("test operation has no value: %w", ErrMissing)
+	}
 
-		if self.equal(op.value()) {
+	if path == "" {
+		if rootNode(doc).equal(op.value()) {
 			return nil
 		}
 
@@ -1101,7 +1271,7 @@ func (p Patch) test(doc *container, op Operation, options *ApplyOptions) error {
 	}
 
 	val, err := con.get(key, options)
-	if err != nil && errors.Unwrap(err) != ErrMissing {
+	if err != nil && (errors.Unwrap(err) != ErrMissing || options.Strict) {
 		return fmt.Errorf("error in test for path: '%s': %w", path, err)
 	}
 
@@ -1124,20 +1294,26 @@ func (p Patch) test(doc *container, op Operation, options *ApplyOptions) error {
 }
 
 func (p Patch) copy(doc *container, op Operation, accumulatedCopySize *int64, options *ApplyOptions) error {
-	from, err := op.From()
+	from, err := op.resolveFrom(options)
 	if err != nil {
 		return fmt.Errorf("copy operation failed to decode from: %w", err)
 	}
 
-	con, key := findObject(doc, from, options)
+	var val *lazyNode
 
-	if con == nil {
-		return fmt.Errorf("copy operation does not apply: doc is missing from path: \"%s\": %w", from, ErrMissing)
-	}
+	if from == "" && options.Strict {
+		val = rootNode(doc)
+	} else {
+		con, key := findObject(doc, from, options)
 
-	val, err := con.get(key, options)
-	if err != nil {
-		return fmt.Errorf("error in copy for from: '%s': %w", from, err)
+		if con == nil {
+			return fmt.Errorf("copy operation does not apply: doc is missing from path: \"%s\": %w", from, ErrMissing)
+		}
+
+		val, err = con.get(key, options)
+		if err != nil {
+			return fmt.Errorf("error in copy for from: '%s': %w", from, err)
+		}
 	}
 
 	path, err := op.Path()
@@ -1145,7 +1321,7 @@ func (p Patch) copy(doc *container, op Operation, accumulatedCopySize *int64, op
 		return fmt.Errorf("copy operation failed to decode path: %w", ErrMissing)
 	}
 
-	con, key = findObject(doc, path, options)
+	con, key := findObject(doc, path, options)
 
 	if con == nil {
 		return fmt.Errorf("copy operation does not apply: doc is missing destination path: %s: %w", path, ErrMissing)
@@ -1158,11 +1334,14 @@ func (p Patch) copy(doc *container, op Operation, accumulatedCopySize *int64, op
 
 	(*accumulatedCopySize) += int64(sz)
 	if options.AccumulatedCopySizeLimit > 0 && *accumulatedCopySize > options.AccumulatedCopySizeLimit {
-		return NewAccumulatedCopySizeError(options.AccumulatedCopySizeLimit, *accumulatedCopySize)
+		err = NewAccumulatedCopySizeError(options.AccumulatedCopySizeLimit, *accumulatedCopySize)
+		(*accumulatedCopySize) -= int64(sz)
+		return err
 	}
 
 	err = con.add(key, valCopy, options)
 	if err != nil {
+		(*accumulatedCopySize) -= int64(sz)
 		return fmt.Errorf("error while adding value during copy: %w", err)
 	}
 
@@ -1179,6 +1358,12 @@ func Equal(a, b []byte) bool {
 
 // DecodePatch decodes the passed JSON document as an RFC 6902 patch.
 func DecodePatch(buf []byte) (Patch, error) {
+	return DecodePatchWithOptions(buf, NewApplyOptions())
+}
+
+// DecodePatchWithOptions decodes the passed JSON document as an RFC 6902
+// patch, which may also hold operations of the kinds registered in options.
+func DecodePatchWithOptions(buf []byte, options *ApplyOptions) (Patch, error) {
 	if !json.Valid(buf) {
 		return nil, ErrInvalid
 	}
@@ -1191,7 +1376,13 @@ func DecodePatch(buf []byte) (Patch, error) {
 		return nil, err
 	}
 
-	if err := validatePatch(p); err != nil {
+	if options.Strict {
+		if err := checkDuplicateMembers(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validatePatch(p, options.effective()); err != nil {
 		return nil, err
 	}
 
@@ -1223,6 +1414,28 @@ func (p Patch) ApplyIndentWithOptions(doc []byte, indent string, options *ApplyO
 		return doc, nil
 	}
 
+	options = options.effective()
+
+	pd, err := newContainer(doc, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var accumulatedCopySize int64
+
+	for i, op := range p {
+		err = p.applyOperation(&pd, op, &accumulatedCopySize, options)
+		if err != nil {
+			return nil, NewPatchError(i, op, err)
+		}
+	}
+
+	return marshalContainer(pd, indent, options)
+}
+
+// newContainer decodes doc into the container the operations of a patch are
+// applied to.
+func newContainer(doc []byte, options *ApplyOptions) (container, error) {
 	if !json.Valid(doc) {
 		return nil, ErrInvalid
 	}
@@ -1248,33 +1461,40 @@ func (p Patch) ApplyIndentWithOptions(doc []byte, indent string, options *ApplyO
 		return nil, err
 	}
 
-	err = nil
+	return pd, nil
+}
 
-	var accumulatedCopySize int64
+func (p Patch) applyOperation(pd *container, op Operation, accumulatedCopySize *int64, options *ApplyOptions) error {
+	if isExpandedOperation(op, options) {
+		return p.applyExpanded(pd, op, accumulatedCopySize, options)
+	}
 
-	for _, op := range p {
-		switch op.Kind() {
-		case "add":
-			err = p.add(&pd, op, options)
-		case "remove":
-			err = p.remove(&pd, op, options)
-		case "replace":
-			err = p.replace(&pd, op, options)
-		case "move":
-			err = p.move(&pd, op, options)
-		case "test":
-			err = p.test(&pd, op, options)
-		case "copy":
-			err = p.copy(&pd, op, &accumulatedCopySize, options)
-		default:
-			err = fmt.Errorf("Unexpected kind: %s", op.Kind())
-		}
+	if holds, err := p.conditionHolds(pd, op, options); err != nil || !holds {
+		return err
+	}
 
-		if err != nil {
-			return nil, err
+	switch op.Kind() {
+	case "add":
+		return p.add(pd, op, options)
+	case "remove":
+		return p.remove(pd, op, options)
+	case "replace":
+		return p.replace(pd, op, options)
+	case "move":
+		return p.move(pd, op, options)
+	case "test":
+		return p.test(pd, op, options)
+	case "copy":
+		return p.copy(pd, op, accumulatedCopySize, options)
+	default:
+		if handler, ok := options.CustomOperations[op.Kind()]; ok {
+			return p.custom(pd, op, handler, options)
 		}
+		return fmt.Errorf("Unexpected kind: %s", op.Kind())
 	}
+}
 
+func marshalContainer(pd container, indent string, options *ApplyOptions) ([]byte, error) {
 	data, err := json.MarshalEscaped(pd, options.EscapeHTML)
 	if err != nil {
 		return nil, err
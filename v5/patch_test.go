@@ -3,6 +3,7 @@ package jsonpatch
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -1033,6 +1034,55 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestPatchError(t *testing.T) {
+	cases := []struct {
+		doc, patch string
+		index      int
+		op         string
+		path, from string
+		cause      error
+	}{
+		{
+			`{"a": 1}`,
+			`[{"op": "test", "path": "/a", "value": 1}, {"op": "test", "path": "/a", "value": 2}]`,
+			1, "test", "/a", "", ErrTestFailed,
+		},
+		{
+			`{"a": 1}`,
+			`[{"op": "remove", "path": "/b"}]`,
+			0, "remove", "/b", "", ErrMissing,
+		},
+		{
+			`{"a": [1]}`,
+			`[{"op": "add", "path": "/b", "value": 1}, {"op": "replace", "path": "/a/2", "value": 2}]`,
+			1, "replace", "/a/2", "", ErrMissing,
+		},
+		{
+			`{"a": [1]}`,
+			`[{"op": "move", "from": "/a/3", "path": "/b"}]`,
+			0, "move", "/b", "/a/3", ErrInvalidIndex,
+		},
+	}
+
+	for _, c := range cases {
+		_, err := applyPatch(c.doc, c.patch)
+
+		var patchErr *PatchError
+		if !errors.As(err, &patchErr) {
+			t.Errorf("Expected a PatchError applying %s, got %v", c.patch, err)
+			continue
+		}
+
+		if patchErr.Index != c.index || patchErr.Op != c.op || patchErr.Path != c.path || patchErr.From != c.from {
+			t.Errorf("Unexpected PatchError applying %s: %+v", c.patch, patchErr)
+		}
+
+		if !errors.Is(err, c.cause) {
+			t.Errorf("Expected error applying %s to match %v, got %v", c.patch, c.cause, err)
+		}
+	}
+}
+
 type EqualityCase struct {
 	name  string
 	a, b  string
@@ -1130,6 +1180,18 @@ var EqualityCases = []EqualityCase{
 		`{"name": "\u03BBJohn"}`,
 		true,
 	},
+	{
+		"NullElementsTrue",
+		`[null, {"a": null}]`,
+		`[null, {"a": null}]`,
+		true,
+	},
+	{
+		"NullElementFalse",
+		`[null]`,
+		`[{}]`,
+		false,
+	},
 }
 
 func TestEquality(t *testing.T) {
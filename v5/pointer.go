@@ -0,0 +1,329 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// ErrInvalidPointer is returned when a string is not a valid JSON Pointer.
+var ErrInvalidPointer = errors.New("invalid JSON Pointer")
+
+// Pointer is an RFC 6901 JSON Pointer, such as "/a/0/b". The zero value
+// points to the whole document.
+type Pointer struct {
+	// tokens are the reference tokens, unescaped.
+	tokens []string
+}
+
+// NewPointer returns the Pointer made of the passed in reference tokens,
+// which are used as is, without unescaping "~0" and "~1".
+func NewPointer(tokens ...string) Pointer {
+	return Pointer{tokens: append([]string(nil), tokens...)}
+}
+
+// ParsePointer parses a JSON Pointer, either in its string form, such as
+// "/a~1b/c", or in its URI fragment form, such as "#/a~1b/c%20d".
+func ParsePointer(s string) (Pointer, error) {
+	str := s
+
+	if strings.HasPrefix(s, "#") {
+		var err error
+		if str, err = url.PathUnescape(s[1:]); err != nil {
+			return Pointer{}, fmt.Errorf("%q: %v: %w", s, err, ErrInvalidPointer)
+		}
+	}
+
+	if str == "" {
+		return Pointer{}, nil
+	}
+
+	if str[0] != '/' {
+		return Pointer{}, fmt.Errorf("%q does not start with '/': %w", s, ErrInvalidPointer)
+	}
+
+	tokens := strings.Split(str[1:], "/")
+
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || token[j+1] != '0' && token[j+1] != '1') {
+				return Pointer{}, fmt.Errorf("%q has an invalid escape in %q: %w", s, token, ErrInvalidPointer)
+			}
+		}
+
+		tokens[i] = decodePatchKey(token)
+	}
+
+	return Pointer{tokens: tokens}, nil
+}
+
+// MustParsePointer is like ParsePointer but panics if s is not a valid JSON
+// Pointer.
+func MustParsePointer(s string) Pointer {
+	p, err := ParsePointer(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// String returns the string form of the pointer, with "~" and "/" escaped
+// within its reference tokens.
+func (p Pointer) String() string {
+	var sb strings.Builder
+
+	for _, token := range p.tokens {
+		sb.WriteByte('/')
+		sb.WriteString(encodePatchKey(token))
+	}
+
+	return sb.String()
+}
+
+// URIFragment returns the URI fragment form of the pointer, such as
+// "#/a%20b".
+func (p Pointer) URIFragment() string {
+	u := url.URL{Fragment: p.String()}
+	return "#" + u.EscapedFragment()
+}
+
+// Tokens returns the unescaped reference tokens of the pointer.
+func (p Pointer) Tokens() []string {
+	return append([]string(nil), p.tokens...)
+}
+
+// Append returns the pointer to the member or element token of the value p
+// points to. The token is used as is, without unescaping "~0" and "~1".
+func (p Pointer) Append(token string) Pointer {
+	tokens := make([]string, len(p.tokens), len(p.tokens)+1)
+	copy(tokens, p.tokens)
+
+	return Pointer{tokens: append(tokens, token)}
+}
+
+// Parent returns the pointer to the value containing the one p points to.
+// The parent of the whole document is the whole document.
+func (p Pointer) Parent() Pointer {
+	if len(p.tokens) == 0 {
+		return p
+	}
+
+	return NewPointer(p.tokens[:len(p.tokens)-1]...)
+}
+
+// IsRoot reports whether p points to the whole document.
+func (p Pointer) IsRoot() bool {
+	return len(p.tokens) == 0
+}
+
+// MarshalJSON encodes the pointer as a JSON string.
+func (p Pointer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON decodes a pointer from a JSON string.
+func (p *Pointer) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := ParsePointer(s)
+	if err != nil {
+		return err
+	}
+
+	*p = parsed
+	return nil
+}
+
+// PathPointer reads the "path" field of the Operation as a Pointer.
+func (o Operation) PathPointer() (Pointer, error) {
+	path, err := o.Path()
+	if err != nil {
+		return Pointer{}, err
+	}
+
+	return ParsePointer(path)
+}
+
+// FromPointer reads the "from" field of the Operation as a Pointer.
+func (o Operation) FromPointer() (Pointer, error) {
+	from, err := o.From()
+	if err != nil {
+		return Pointer{}, err
+	}
+
+	return ParsePointer(from)
+}
+
+// resolveFrom reads the "from" field of the Operation, resolving it against
+// the "path" field if it is a Relative JSON Pointer and options allow it.
+func (o Operation) resolveFrom(options *ApplyOptions) (string, error) {
+	from, err := o.From()
+	if err != nil || !options.AllowRelativeFrom || from == "" || from[0] == '/' {
+		return from, err
+	}
+
+	r, err := ParseRelativePointer(from)
+	if err != nil {
+		return "unknown", err
+	}
+
+	if r.Key {
+		return "unknown", fmt.Errorf("%q refers to a name rather than a value: %w", from, ErrInvalidPointer)
+	}
+
+	context, err := o.PathPointer()
+	if err != nil {
+		return "unknown", err
+	}
+
+	p, err := r.Resolve(context)
+	if err != nil {
+		return "unknown", err
+	}
+
+	return p.String(), nil
+}
+
+// SetPath sets the "path" field of the Operation.
+func (o Operation) SetPath(p Pointer) {
+	o["path"] = rawString(p.String())
+}
+
+// SetFrom sets the "from" field of the Operation.
+func (o Operation) SetFrom(p Pointer) {
+	o["from"] = rawString(p.String())
+}
+
+// RelativePointer is a Relative JSON Pointer, such as "1/a" or "0#", which
+// identifies a value relative to a context location in a document.
+type RelativePointer struct {
+	// Up is the number of levels to go up from the context location.
+	Up int
+	// Shift is added to the array index reached after going up, to refer
+	// to a sibling element.
+	Shift int
+	// Pointer is followed from the location reached after going up and
+	// shifting.
+	Pointer Pointer
+	// Key is set when the relative pointer ends with "#", in which case it
+	// refers to the member name or array index of the location reached after
+	// going up and shifting, rather than to its value.
+	Key bool
+}
+
+// ParseRelativePointer parses a Relative JSON Pointer.
+func ParseRelativePointer(s string) (RelativePointer, error) {
+	var r RelativePointer
+
+	n := leadingDigits(s)
+	if n == 0 || n > 1 && s[0] == '0' {
+		return r, fmt.Errorf("%q does not start with a non-negative integer: %w", s, ErrInvalidPointer)
+	}
+
+	r.Up, _ = strconv.Atoi(s[:n])
+	rest := s[n:]
+
+	if rest != "" && (rest[0] == '+' || rest[0] == '-') {
+		m := leadingDigits(rest[1:])
+		if m == 0 || m > 1 && rest[1] == '0' {
+			return r, fmt.Errorf("%q has an invalid index manipulation: %w", s, ErrInvalidPointer)
+		}
+
+		r.Shift, _ = strconv.Atoi(rest[1 : m+1])
+		if rest[0] == '-' {
+			r.Shift = -r.Shift
+		}
+		rest = rest[m+1:]
+	}
+
+	if rest == "#" {
+		r.Key = true
+		return r, nil
+	}
+
+	if rest != "" && rest[0] != '/' {
+		return r, fmt.Errorf("%q does not end with '#' or a JSON Pointer: %w", s, ErrInvalidPointer)
+	}
+
+	p, err := ParsePointer(rest)
+	if err != nil {
+		return r, fmt.Errorf("%q: %w", s, err)
+	}
+
+	r.Pointer = p
+	return r, nil
+}
+
+func leadingDigits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+
+	return n
+}
+
+// String returns the string form of the relative pointer.
+func (r RelativePointer) String() string {
+	s := strconv.Itoa(r.Up)
+
+	if r.Shift > 0 {
+		s += "+" + strconv.Itoa(r.Shift)
+	} else if r.Shift < 0 {
+		s += strconv.Itoa(r.Shift)
+	}
+
+	if r.Key {
+		return s + "#"
+	}
+
+	return s + r.Pointer.String()
+}
+
+// Resolve returns the absolute pointer r refers to from the context location.
+// When r.Key is set, that is the location whose member name or array index r
+// refers to.
+func (r RelativePointer) Resolve(context Pointer) (Pointer, error) {
+	if r.Up > len(context.tokens) {
+		return Pointer{}, fmt.Errorf("%s goes above the root of %s: %w", r, context, ErrInvalidPointer)
+	}
+
+	base := NewPointer(context.tokens[:len(context.tokens)-r.Up]...)
+
+	if r.Shift != 0 {
+		if base.IsRoot() {
+			return Pointer{}, fmt.Errorf("%s shifts the root of %s: %w", r, context, ErrInvalidPointer)
+		}
+
+		last := base.tokens[len(base.tokens)-1]
+
+		idx, err := strconv.Atoi(last)
+		if err != nil || idx < 0 || !isIndexToken(last) {
+			return Pointer{}, fmt.Errorf("%s shifts %s which is not an array index: %w", r, last, ErrInvalidPointer)
+		}
+
+		if idx+r.Shift < 0 {
+			return Pointer{}, fmt.Errorf("%s shifts %s below 0: %w", r, last, ErrInvalidPointer)
+		}
+
+		base.tokens[len(base.tokens)-1] = strconv.Itoa(idx + r.Shift)
+	}
+
+	if r.Key && base.IsRoot() {
+		return Pointer{}, fmt.Errorf("%s refers to the name of the root of %s: %w", r, context, ErrInvalidPointer)
+	}
+
+	for _, token := range r.Pointer.tokens {
+		base = base.Append(token)
+	}
+
+	return base, nil
+}
@@ -0,0 +1,240 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePointer(t *testing.T) {
+	cases := []struct {
+		in       string
+		tokens   []string
+		str      string
+		fragment string
+	}{
+		{"", nil, "", "#"},
+		{"/", []string{""}, "/", "#/"},
+		{"/a/0", []string{"a", "0"}, "/a/0", "#/a/0"},
+		{"/a~1b/c~0d", []string{"a/b", "c~d"}, "/a~1b/c~0d", "#/a~1b/c~0d"},
+		{"/~01", []string{"~1"}, "/~01", "#/~01"},
+		{"#/a%20b/c%25d", []string{"a b", "c%d"}, "/a b/c%d", "#/a%20b/c%25d"},
+		{"#", nil, "", "#"},
+	}
+
+	for _, c := range cases {
+		p, err := ParsePointer(c.in)
+		if err != nil {
+			t.Errorf("Unable to parse %q: %s", c.in, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(p.Tokens(), append([]string(nil), c.tokens...)) {
+			t.Errorf("Parsing %q: expected tokens %q, got %q", c.in, c.tokens, p.Tokens())
+		}
+
+		if p.String() != c.str {
+			t.Errorf("Parsing %q: expected %q, got %q", c.in, c.str, p.String())
+		}
+
+		if p.URIFragment() != c.fragment {
+			t.Errorf("Parsing %q: expected fragment %q, got %q", c.in, c.fragment, p.URIFragment())
+		}
+	}
+}
+
+func TestParsePointerInvalid(t *testing.T) {
+	for _, in := range []string{"a", "/a~", "/a~2", "#a", "#/a%2"} {
+		if _, err := ParsePointer(in); !errors.Is(err, ErrInvalidPointer) {
+			t.Errorf("Expected ErrInvalidPointer parsing %q, got %v", in, err)
+		}
+	}
+}
+
+func TestPointerTraversal(t *testing.T) {
+	p := NewPointer("a").Append("b/c").Append("~")
+
+	if p.String() != "/a/b~1c/~0" {
+		t.Errorf("Unexpected pointer %s", p)
+	}
+
+	parent := p.Parent()
+	if parent.String() != "/a/b~1c" {
+		t.Errorf("Unexpected parent %s", parent)
+	}
+
+	// Appending to a parent must not change the child it was taken from.
+	parent.Append("x")
+	if p.String() != "/a/b~1c/~0" {
+		t.Errorf("Appending to the parent changed the pointer to %s", p)
+	}
+
+	var root Pointer
+	if !root.IsRoot() || !root.Parent().IsRoot() || root.Append("").String() != "/" {
+		t.Errorf("Unexpected root pointer behaviour")
+	}
+}
+
+func TestOperationPointers(t *testing.T) {
+	op := Operation{}
+	op["op"] = rawString("move")
+	op.SetFrom(NewPointer("a/b"))
+	op.SetPath(NewPointer("c", "0"))
+
+	out, err := Patch{op}.Apply([]byte(`{"a/b": 1, "c": [2]}`))
+	if err != nil {
+		t.Fatalf("Unable to apply patch: %s", err)
+	}
+
+	if !compareJSON(string(out), `{"c": [1, 2]}`) {
+		t.Errorf("Unexpected document %s", out)
+	}
+
+	from, err := op.FromPointer()
+	if err != nil || !reflect.DeepEqual(from.Tokens(), []string{"a/b"}) {
+		t.Errorf("Unexpected from %v: %v", from.Tokens(), err)
+	}
+
+	var decoded struct {
+		Path Pointer `json:"path"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"path": "/x~1y"}`), &decoded); err != nil {
+		t.Fatalf("Unable to decode pointer: %s", err)
+	}
+
+	buf, _ := json.Marshal(decoded)
+	if string(buf) != `{"path":"/x~1y"}` {
+		t.Errorf("Unexpected encoding %s", buf)
+	}
+}
+
+func TestRelativePointer(t *testing.T) {
+	context := MustParsePointer("/a/b/1/c")
+
+	cases := []struct {
+		rel, result string
+		key         bool
+	}{
+		{"0", "/a/b/1/c", false},
+		{"1/d", "/a/b/1/d", false},
+		{"2", "/a/b", false},
+		{"1-1/c", "/a/b/0/c", false},
+		{"1+2", "/a/b/3", false},
+		{"4", "", false},
+		{"0#", "/a/b/1/c", true},
+		{"3/x~1y", "/a/x~1y", false},
+	}
+
+	for _, c := range cases {
+		r, err := ParseRelativePointer(c.rel)
+		if err != nil {
+			t.Errorf("Unable to parse %q: %s", c.rel, err)
+			continue
+		}
+
+		if r.String() != c.rel || r.Key != c.key {
+			t.Errorf("Parsing %q gave %s, key %v", c.rel, r, r.Key)
+		}
+
+		p, err := r.Resolve(context)
+		if err != nil {
+			t.Errorf("Unable to resolve %q: %s", c.rel, err)
+			continue
+		}
+
+		if p.String() != c.result {
+			t.Errorf("Resolving %q: expected %q, got %q", c.rel, c.result, p)
+		}
+	}
+}
+
+func TestRelativePointerInvalid(t *testing.T) {
+	for _, s := range []string{"", "/a", "01", "-1", "1+", "1+01", "1a", "1#/a", "0/~2"} {
+		if _, err := ParseRelativePointer(s); !errors.Is(err, ErrInvalidPointer) {
+			t.Errorf("Expected %q to be invalid, got %v", s, err)
+		}
+	}
+
+	context := MustParsePointer("/a/b/1/c")
+
+	for _, s := range []string{"5", "0+1", "1-2", "4#", "2+1"} {
+		r, err := ParseRelativePointer(s)
+		if err != nil {
+			t.Errorf("Unable to parse %q: %s", s, err)
+			continue
+		}
+
+		if _, err := r.Resolve(context); !errors.Is(err, ErrInvalidPointer) {
+			t.Errorf("Expected %q not to resolve from %s, got %v", s, context, err)
+		}
+	}
+}
+
+func TestRelativeFrom(t *testing.T) {
+	cases := []struct {
+		doc, patch, result string
+	}{
+		{
+			`{"a": [{"b": 1}, {"b": 2}]}`,
+			`[{"op": "copy", "from": "1-1/b", "path": "/a/1/c"}]`,
+			`{"a": [{"b": 1}, {"b": 2, "c": 1}]}`,
+		},
+		{
+			`{"a": {"b": 1}}`,
+			`[{"op": "move", "from": "1/b", "path": "/a/c"}]`,
+			`{"a": {"c": 1}}`,
+		},
+		{
+			`{"a": {"b": 1}}`,
+			`[{"op": "copy", "from": "/a/b", "path": "/c"}]`,
+			`{"a": {"b": 1}, "c": 1}`,
+		},
+	}
+
+	options := NewApplyOptions()
+	options.AllowRelativeFrom = true
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		out, err := p.ApplyWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to apply %s: %s", c.patch, err)
+			continue
+		}
+
+		if !compareJSON(string(out), c.result) {
+			t.Errorf("Applying %s: expected %s, got %s", c.patch, c.result, out)
+		}
+
+		inverse, err := p.InvertWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to invert %s: %s", c.patch, err)
+			continue
+		}
+
+		if back, err := inverse.Apply(out); err != nil || !compareJSON(string(back), c.doc) {
+			t.Errorf("Inverting %s gave %s: %v", c.patch, back, err)
+		}
+	}
+
+	for _, patch := range []string{
+		`[{"op": "copy", "from": "0#", "path": "/a/c"}]`,
+		`[{"op": "copy", "from": "3/b", "path": "/a/c"}]`,
+	} {
+		p, _ := DecodePatch([]byte(patch))
+		if _, err := p.ApplyWithOptions([]byte(`{"a": {"b": 1}}`), options); !errors.Is(err, ErrInvalidPointer) {
+			t.Errorf("Applying %s: expected ErrInvalidPointer, got %v", patch, err)
+		}
+	}
+
+	p, _ := DecodePatch([]byte(`[{"op": "copy", "from": "1/b", "path": "/a/c"}]`))
+	if _, err := p.Apply([]byte(`{"a": {"b": 1}}`)); err == nil {
+		t.Errorf("Expected relative from to be rejected by default")
+	}
+}
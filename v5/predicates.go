@@ -0,0 +1,263 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// extendedTestFields are the members of a "test" operation that
+// ApplyOptions.ExtendedTests gives a meaning to, besides "value".
+var extendedTestFields = []string{
+	"not", "exists", "type", "pattern", "contains",
+	"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum",
+}
+
+// isExtendedTest reports whether op is a "test" operation to be evaluated
+// with the extended conditions.
+func isExtendedTest(op Operation, options *ApplyOptions) bool {
+	if !options.ExtendedTests {
+		return false
+	}
+
+	for _, f := range extendedTestFields {
+		if _, ok := op[f]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// extendedTest evaluates a "test" operation holding extended conditions. The
+// test passes if all its conditions hold, or, when "not" is true, if at least
+// one of them does not.
+func (p Patch) extendedTest(doc *container, op Operation, options *ApplyOptions) error {
+	path, err := op.Path()
+	if err != nil {
+		return fmt.Errorf("test operation failed to decode path: %w", err)
+	}
+
+	val, exists := testedValue(doc, path, options)
+
+	ok, err := evalExtendedTest(op, val, exists)
+	if err != nil {
+		return fmt.Errorf("error in test for path: '%s': %w", path, err)
+	}
+
+	var not bool
+	if err := decodeField(op, "not", &not); err != nil {
+		return fmt.Errorf("error in test for path: '%s': %w", path, err)
+	}
+
+	if ok == not {
+		return fmt.Errorf("testing value %s failed: %w", path, ErrTestFailed)
+	}
+
+	return nil
+}
+
+// testedValue returns the value at path, and whether there is one. A nil
+// value that exists is a JSON null.
+func testedValue(doc *container, path string, options *ApplyOptions) (*lazyNode, bool) {
+	if path == "" {
+		return rootNode(doc), true
+	}
+
+	con, key := findObject(doc, path, options)
+	if con == nil {
+		return nil, false
+	}
+
+	val, err := con.get(key, options)
+	if err != nil {
+		return nil, false
+	}
+
+	return val, true
+}
+
+// evalExtendedTest reports whether every condition of op holds for val.
+func evalExtendedTest(op Operation, val *lazyNode, exists bool) (bool, error) {
+	conditions := 0
+	ok := true
+
+	check := func(holds bool) {
+		conditions++
+		ok = ok && holds
+	}
+
+	if _, present := op["exists"]; present {
+		var want bool
+		if err := decodeField(op, "exists", &want); err != nil {
+			return false, err
+		}
+
+		check(exists == want)
+	}
+
+	if _, present := op["value"]; present {
+		check(exists && nullSafeEqual(val, op.value()))
+	}
+
+	if _, present := op["type"]; present {
+		var want string
+		if err := decodeField(op, "type", &want); err != nil {
+			return false, err
+		}
+
+		switch want {
+		case "string", "number", "integer", "object", "array", "null", "boolean":
+		default:
+			return false, fmt.Errorf("unknown type %q: %w", want, ErrInvalid)
+		}
+
+		check(exists && hasJSONType(val, want))
+	}
+
+	if _, present := op["pattern"]; present {
+		var pattern string
+		if err := decodeField(op, "pattern", &pattern); err != nil {
+			return false, err
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern %q: %v: %w", pattern, err, ErrInvalid)
+		}
+
+		var s string
+		check(exists && hasJSONType(val, "string") && unmarshal(*val.raw, &s) == nil && re.MatchString(s))
+	}
+
+	if raw, present := op["contains"]; present {
+		want := newLazyNode(newRawMessage(rawJSONNull))
+		if raw != nil {
+			want = newLazyNode(raw)
+		}
+
+		found := false
+
+		if exists && nodeKind(val) == kindArray {
+			ary, err := val.intoAry()
+			if err != nil {
+				return false, err
+			}
+
+			for _, elem := range ary.nodes {
+				if nullSafeEqual(elem, want) {
+					found = true
+					break
+				}
+			}
+		}
+
+		check(found)
+	}
+
+	for _, bound := range []struct {
+		field string
+		holds func(cmp int) bool
+	}{
+		{"minimum", func(cmp int) bool { return cmp >= 0 }},
+		{"maximum", func(cmp int) bool { return cmp <= 0 }},
+		{"exclusiveMinimum", func(cmp int) bool { return cmp > 0 }},
+		{"exclusiveMaximum", func(cmp int) bool { return cmp < 0 }},
+	} {
+		raw, present := op[bound.field]
+		if !present {
+			continue
+		}
+
+		if raw == nil {
+			return false, fmt.Errorf("%s is not a number: %w", bound.field, ErrInvalid)
+		}
+
+		limit, err := decodeDecimal(*raw)
+		if err != nil {
+			return false, fmt.Errorf("%s is not a number: %w", bound.field, ErrInvalid)
+		}
+
+		holds := false
+
+		if exists && hasJSONType(val, "number") {
+			n, err := decodeDecimal(*val.raw)
+			if err != nil {
+				return false, err
+			}
+
+			holds = bound.holds(n.cmp(limit))
+		}
+
+		check(holds)
+	}
+
+	if conditions == 0 {
+		return false, fmt.Errorf("test operation has no condition: %w", ErrMissing)
+	}
+
+	return ok, nil
+}
+
+// decodeField decodes the member of op with the given name, if there is one.
+func decodeField(op Operation, name string, v interface{}) error {
+	raw, ok := op[name]
+	if !ok {
+		return nil
+	}
+
+	if raw == nil {
+		return fmt.Errorf("%s is null: %w", name, ErrInvalid)
+	}
+
+	if err := unmarshal(*raw, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v: %w", name, err, ErrInvalid)
+	}
+
+	return nil
+}
+
+// nullSafeEqual compares values that may be JSON nulls, as nil nodes or not.
+func nullSafeEqual(a, b *lazyNode) bool {
+	if an, bn := nodeKind(a) == kindNull, nodeKind(b) == kindNull; an || bn {
+		return an && bn
+	}
+
+	return a.equal(b)
+}
+
+// hasJSONType reports whether val is of the given JSON type. An "integer" is a
+// number without a fractional part.
+func hasJSONType(val *lazyNode, typ string) bool {
+	kind := nodeKind(val)
+
+	switch typ {
+	case "null":
+		return kind == kindNull
+	case "object":
+		return kind == kindObject
+	case "array":
+		return kind == kindArray
+	}
+
+	if kind != kindScalar {
+		return false
+	}
+
+	switch c := val.nextByte(); typ {
+	case "string":
+		return c == '"'
+	case "boolean":
+		return c == 't' || c == 'f'
+	case "number":
+		return c == '-' || c >= '0' && c <= '9'
+	case "integer":
+		if c != '-' && (c < '0' || c > '9') {
+			return false
+		}
+
+		n, err := decodeDecimal(*val.raw)
+		return err == nil && n.isInteger()
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+var predicatesDoc = `{
+  "version": 3,
+  "price": 12.5,
+  "name": "widget-42",
+  "tags": ["a", {"b": 1}, null],
+  "meta": {"owner": null},
+  "enabled": true
+}`
+
+func TestExtendedTests(t *testing.T) {
+	cases := []struct {
+		test string
+		pass bool
+	}{
+		{`{"op": "test", "path": "/lock", "exists": false}`, true},
+		{`{"op": "test", "path": "/version", "exists": false}`, false},
+		{`{"op": "test", "path": "/meta/owner", "exists": true}`, true},
+		{`{"op": "test", "path": "/x/y", "exists": true, "not": true}`, true},
+		{`{"op": "test", "path": "/version", "minimum": 3}`, true},
+		{`{"op": "test", "path": "/version", "minimum": 3.5}`, false},
+		{`{"op": "test", "path": "/version", "exclusiveMinimum": 3}`, false},
+		{`{"op": "test", "path": "/price", "minimum": 10, "exclusiveMaximum": 12.6}`, true},
+		{`{"op": "test", "path": "/price", "maximum": 1e1}`, false},
+		{`{"op": "test", "path": "/price", "minimum": -1e100000, "maximum": 1e100000}`, true},
+		{`{"op": "test", "path": "/name", "minimum": 1}`, false},
+		{`{"op": "test", "path": "/name", "type": "string", "pattern": "^widget-[0-9]+$"}`, true},
+		{`{"op": "test", "path": "/name", "pattern": "^gadget"}`, false},
+		{`{"op": "test", "path": "/version", "pattern": "3"}`, false},
+		{`{"op": "test", "path": "/version", "type": "integer"}`, true},
+		{`{"op": "test", "path": "/price", "type": "integer"}`, false},
+		{`{"op": "test", "path": "/price", "type": "number"}`, true},
+		{`{"op": "test", "path": "/tags", "type": "array"}`, true},
+		{`{"op": "test", "path": "/meta", "type": "object"}`, true},
+		{`{"op": "test", "path": "/meta/owner", "type": "null"}`, true},
+		{`{"op": "test", "path": "/enabled", "type": "boolean"}`, true},
+		{`{"op": "test", "path": "", "type": "object"}`, true},
+		{`{"op": "test", "path": "/missing", "type": "null"}`, false},
+		{`{"op": "test", "path": "/enabled", "type": "string", "not": true}`, true},
+		{`{"op": "test", "path": "/tags", "contains": "a"}`, true},
+		{`{"op": "test", "path": "/tags", "contains": {"b": 1}}`, true},
+		{`{"op": "test", "path": "/tags", "contains": null}`, true},
+		{`{"op": "test", "path": "/tags", "contains": "c"}`, false},
+		{`{"op": "test", "path": "/name", "contains": "w"}`, false},
+		{`{"op": "test", "path": "/version", "value": 3, "not": true}`, false},
+		{`{"op": "test", "path": "/version", "value": 4, "not": true}`, true},
+		{`{"op": "test", "path": "/version", "value": 3, "minimum": 4}`, false},
+	}
+
+	options := NewApplyOptions()
+	options.ExtendedTests = true
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte("[" + c.test + "]"))
+		if err != nil {
+			t.Fatalf("Unable to decode %s: %s", c.test, err)
+		}
+
+		_, err = p.ApplyWithOptions([]byte(predicatesDoc), options)
+
+		switch {
+		case c.pass && err != nil:
+			t.Errorf("Expected %s to pass, got %s", c.test, err)
+		case !c.pass && !errors.Is(err, ErrTestFailed):
+			t.Errorf("Expected %s to fail, got %v", c.test, err)
+		}
+	}
+}
+
+func TestExtendedTestErrors(t *testing.T) {
+	cases := []struct {
+		test string
+		err  error
+	}{
+		{`{"op": "test", "path": "/version", "type": "float"}`, ErrInvalid},
+		{`{"op": "test", "path": "/name", "pattern": "("}`, ErrInvalid},
+		{`{"op": "test", "path": "/version", "minimum": "1"}`, ErrInvalid},
+		{`{"op": "test", "path": "/version", "exists": "yes"}`, ErrInvalid},
+		{`{"op": "test", "path": "/version", "not": true}`, ErrMissing},
+	}
+
+	options := NewApplyOptions()
+	options.ExtendedTests = true
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte("[" + c.test + "]"))
+		if err != nil {
+			t.Fatalf("Unable to decode %s: %s", c.test, err)
+		}
+
+		if _, err := p.ApplyWithOptions([]byte(predicatesDoc), options); !errors.Is(err, c.err) {
+			t.Errorf("Applying %s: expected %v, got %v", c.test, c.err, err)
+		}
+	}
+
+	// Without ExtendedTests, the extra members are ignored as RFC 6902
+	// requires.
+	p, _ := DecodePatch([]byte(`[{"op": "test", "path": "/version", "value": 3, "not": true}]`))
+	if _, err := p.Apply([]byte(predicatesDoc)); err != nil {
+		t.Errorf("Expected the test to pass, got %s", err)
+	}
+}
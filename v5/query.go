@@ -0,0 +1,121 @@
+package jsonpatch
+
+import (
+	"fmt"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// GetPointer returns the JSON encoded value at ptr within doc. Only the
+// values along ptr are decoded, the rest of doc is left as is. ptr is
+// resolved as RFC 6901 specifies: "" is the name of a member, and an array
+// index has no sign and no leading zeros.
+func GetPointer(doc []byte, ptr string) ([]byte, error) {
+	p, err := parseQuery(doc, ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.IsRoot() {
+		return doc, nil
+	}
+
+	options := queryOptions()
+
+	_, con, key, err := findPointer(doc, p, options)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := con.get(key, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalEscaped(val, false)
+}
+
+// HasPointer reports whether there is a value at ptr within doc.
+func HasPointer(doc []byte, ptr string) bool {
+	_, err := GetPointer(doc, ptr)
+	return err == nil
+}
+
+// SetPointer returns doc with the value at ptr set to the JSON encoded value.
+// A missing member of an object is added, while an element of an array must
+// exist, unless ptr ends with "-" to append one.
+func SetPointer(doc []byte, ptr string, value []byte) ([]byte, error) {
+	if !json.Valid(value) {
+		return nil, ErrBadJSONPatch
+	}
+
+	p, err := parseQuery(doc, ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.IsRoot() {
+		return value, nil
+	}
+
+	options := queryOptions()
+
+	pd, con, key, err := findPointer(doc, p, options)
+	if err != nil {
+		return nil, err
+	}
+
+	val := newLazyNode(newRawMessage(value))
+
+	if _, ok := con.(*partialArray); ok && key == "-" {
+		err = con.add(key, val, options)
+	} else {
+		err = con.set(key, val, options)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalContainer(pd, "", options)
+}
+
+// queryOptions returns the options pointers are resolved with, which follow
+// RFC 6901 rather than the lenient rules of patch paths.
+func queryOptions() *ApplyOptions {
+	options := NewApplyOptions()
+	options.Strict = true
+
+	return options.effective()
+}
+
+func parseQuery(doc []byte, ptr string) (Pointer, error) {
+	p, err := ParsePointer(ptr)
+	if err != nil {
+		return Pointer{}, err
+	}
+
+	if !json.Valid(doc) {
+		return Pointer{}, ErrBadJSONDoc
+	}
+
+	return p, nil
+}
+
+// findPointer decodes the top level of doc, and returns it along with the
+// container of the value at p and its key within that container.
+func findPointer(doc []byte, p Pointer, options *ApplyOptions) (container, container, string, error) {
+	path := p.String()
+
+	pd, err := newContainer(doc, options)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("doc is missing path: %s: %w", path, ErrMissing)
+	}
+
+	con, key := findObject(&pd, path, options)
+	if con == nil {
+		return nil, nil, "", fmt.Errorf("doc is missing path: %s: %w", path, ErrMissing)
+	}
+
+	return pd, con, key, nil
+}
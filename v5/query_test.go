@@ -0,0 +1,127 @@
+package jsonpatch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var pointerDoc = `{"a": {"b": [1, {"c": null}], "d~e/f": "g"}, "h": "<i>"}`
+
+func TestGetPointer(t *testing.T) {
+	cases := []struct {
+		ptr, value string
+	}{
+		{"", pointerDoc},
+		{"/a/b", `[1, {"c": null}]`},
+		{"/a/b/0", `1`},
+		{"/a/b/1/c", `null`},
+		{"/a/d~0e~1f", `"g"`},
+		{"#/a/d~0e~1f", `"g"`},
+		{"/h", `"<i>"`},
+	}
+
+	emptyKey := []byte(`{"": 5, "a": 1, "01": 2}`)
+	if out, _ := GetPointer(emptyKey, "/"); string(out) != `5` {
+		t.Errorf("Expected \"/\" to refer to the \"\" member, got %s", out)
+	}
+	if out, _ := GetPointer(emptyKey, "/01"); string(out) != `2` {
+		t.Errorf("Expected \"/01\" to refer to the \"01\" member, got %s", out)
+	}
+
+	if out, _ := GetPointer([]byte(pointerDoc), "/h"); string(out) != `"<i>"` {
+		t.Errorf("Expected the value as found in the document, got %s", out)
+	}
+
+	for _, c := range cases {
+		out, err := GetPointer([]byte(pointerDoc), c.ptr)
+		if err != nil {
+			t.Errorf("Unable to get %q: %s", c.ptr, err)
+			continue
+		}
+
+		if !compareJSON(string(out), c.value) {
+			t.Errorf("Getting %q: expected %s, got %s", c.ptr, c.value, out)
+		}
+
+		if !HasPointer([]byte(pointerDoc), c.ptr) {
+			t.Errorf("Expected %q to exist", c.ptr)
+		}
+	}
+}
+
+func TestGetPointerErrors(t *testing.T) {
+	cases := []struct {
+		doc, ptr string
+		err      error
+	}{
+		{pointerDoc, "/x", ErrMissing},
+		{pointerDoc, "/a/x/y", ErrMissing},
+		{pointerDoc, "/a/b/2", ErrInvalidIndex},
+		{pointerDoc, "/a/b/-1", ErrInvalidIndex},
+		{pointerDoc, "/a/b/01", ErrInvalidIndex},
+		{pointerDoc, "/a/b/", ErrInvalidIndex},
+		{pointerDoc, "/", ErrMissing},
+		{`{"a": 1}`, "/", ErrMissing},
+		{pointerDoc, "a", ErrInvalidPointer},
+		{`1`, "/a", ErrMissing},
+		{`{`, "/a", ErrBadJSONDoc},
+	}
+
+	for _, c := range cases {
+		if _, err := GetPointer([]byte(c.doc), c.ptr); !errors.Is(err, c.err) {
+			t.Errorf("Getting %q from %s: expected %v, got %v", c.ptr, c.doc, c.err, err)
+		}
+
+		if HasPointer([]byte(c.doc), c.ptr) {
+			t.Errorf("Expected %q not to exist in %s", c.ptr, c.doc)
+		}
+	}
+}
+
+func TestSetPointer(t *testing.T) {
+	cases := []struct {
+		ptr, value, result string
+		err                error
+	}{
+		{"/a/b/0", `2`, `{"a": {"b": [2, {"c": null}], "d~e/f": "g"}, "h": "<i>"}`, nil},
+		{"/a/b/-", `3`, `{"a": {"b": [1, {"c": null}, 3], "d~e/f": "g"}, "h": "<i>"}`, nil},
+		{"/a/x", `{}`, `{"a": {"b": [1, {"c": null}], "d~e/f": "g", "x": {}}, "h": "<i>"}`, nil},
+		{"/h", `null`, `{"a": {"b": [1, {"c": null}], "d~e/f": "g"}, "h": null}`, nil},
+		{"", `[]`, `[]`, nil},
+		{"/", `2`, `{"": 2, "a": {"b": [1, {"c": null}], "d~e/f": "g"}, "h": "<i>"}`, nil},
+		{"/a/b/2", `2`, ``, ErrInvalidIndex},
+		{"/a/b/01", `2`, ``, ErrInvalidIndex},
+		{"/a/b/", `2`, ``, ErrInvalidIndex},
+		{"/x/y", `2`, ``, ErrMissing},
+		{"/a", `{`, ``, ErrBadJSONPatch},
+	}
+
+	for _, c := range cases {
+		out, err := SetPointer([]byte(pointerDoc), c.ptr, []byte(c.value))
+
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("Setting %q: expected %v, got %v", c.ptr, c.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unable to set %q: %s", c.ptr, err)
+			continue
+		}
+
+		if !compareJSON(string(out), c.result) {
+			t.Errorf("Setting %q: expected %s, got %s", c.ptr, c.result, out)
+		}
+
+		if c.ptr == "" || strings.HasSuffix(c.ptr, "/-") {
+			continue
+		}
+
+		if got, err := GetPointer(out, c.ptr); err != nil || !compareJSON(string(got), c.value) {
+			t.Errorf("Getting %q back: expected %s, got %s (%v)", c.ptr, c.value, got, err)
+		}
+	}
+}
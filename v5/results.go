@@ -0,0 +1,136 @@
+package jsonpatch
+
+// OperationStatus tells what happened to an operation applied by
+// ApplyWithResults.
+type OperationStatus int
+
+const (
+	// OperationApplied means the operation changed the document, or that
+	// its test passed.
+	OperationApplied OperationStatus = iota
+	// OperationSkipped means the operation was not attempted, as an earlier
+	// one failed and ContinueOnError was not set, or as its "if" clause did
+	// not hold.
+	OperationSkipped
+	// OperationFailed means the operation did not apply, and left the
+	// document unchanged.
+	OperationFailed
+)
+
+func (s OperationStatus) String() string {
+	switch s {
+	case OperationApplied:
+		return "applied"
+	case OperationSkipped:
+		return "skipped"
+	case OperationFailed:
+		return "failed"
+	}
+
+	return "unknown"
+}
+
+// OperationResult is the outcome of a single operation applied by
+// ApplyWithResults.
+type OperationResult struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	// Op is the kind of the operation, such as "add".
+	Op string
+	// Path is the "path" of the operation, as found in the patch.
+	Path   string
+	Status OperationStatus
+	// Err is the *PatchError the operation failed with, if it did.
+	Err error
+}
+
+// ApplyWithResults mutates a JSON document according to the patch and the
+// passed in ApplyOptions, and returns one OperationResult per operation.
+//
+// If an operation fails and options.ContinueOnError is set, the remaining
+// operations are still applied, and the document they produce is returned
+// along with a nil error. Otherwise the remaining operations are skipped, and
+// the error of the failed operation is returned instead of a document.
+func (p Patch) ApplyWithResults(doc []byte, options *ApplyOptions) ([]byte, []OperationResult, error) {
+	options = options.effective()
+
+	results := make([]OperationResult, len(p))
+
+	for i, op := range p {
+		results[i] = OperationResult{Index: i, Op: op.Kind(), Status: OperationSkipped}
+
+		if path, err := op.Path(); err == nil {
+			results[i].Path = path
+		}
+	}
+
+	if len(doc) == 0 {
+		for i := range results {
+			results[i].Status = OperationApplied
+		}
+		return doc, results, nil
+	}
+
+	pd, err := newContainer(doc, options)
+	if err != nil {
+		return nil, results, err
+	}
+
+	var accumulatedCopySize int64
+
+	for i, op := range p {
+		if !isExpandedOperation(op, options) {
+			if holds, err := p.conditionHolds(&pd, op, options); err == nil && !holds {
+				continue
+			}
+		}
+
+		err := p.applyOperation(&pd, op, &accumulatedCopySize, options)
+		if err == nil {
+			results[i].Status = OperationApplied
+			continue
+		}
+
+		results[i].Status = OperationFailed
+		results[i].Err = NewPatchError(i, op, err)
+
+		if !options.ContinueOnError {
+			return nil, results, results[i].Err
+		}
+	}
+
+	out, err := marshalContainer(pd, "", options)
+	if err != nil {
+		return nil, results, err
+	}
+
+	return out, results, nil
+}
+
+// Check reports every operation of the patch that fails to apply to doc with
+// the passed in ApplyOptions, as a *PatchError, without producing the patched
+// document. Each operation is checked against the document as changed by the
+// operations before it that succeeded.
+func (p Patch) Check(doc []byte, options *ApplyOptions) []error {
+	if len(doc) == 0 {
+		return nil
+	}
+
+	options = options.effective()
+
+	pd, err := newContainer(doc, options)
+	if err != nil {
+		return []error{err}
+	}
+
+	var accumulatedCopySize int64
+	var errs []error
+
+	for i, op := range p {
+		if err := p.applyOperation(&pd, op, &accumulatedCopySize, options); err != nil {
+			errs = append(errs, NewPatchError(i, op, err))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,230 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyWithResults(t *testing.T) {
+	cases := []struct {
+		doc, patch, result string
+		continueOnError    bool
+		statuses           []OperationStatus
+	}{
+		{
+			`{"a": 1, "b": 2}`,
+			`[
+				{"op": "remove", "path": "/a"},
+				{"op": "remove", "path": "/c"},
+				{"op": "replace", "path": "/b", "value": 3}
+			]`,
+			`{"b": 3}`,
+			true,
+			[]OperationStatus{OperationApplied, OperationFailed, OperationApplied},
+		},
+		{
+			`{"a": 1, "b": 2}`,
+			`[
+				{"op": "remove", "path": "/a"},
+				{"op": "remove", "path": "/c"},
+				{"op": "replace", "path": "/b", "value": 3}
+			]`,
+			``,
+			false,
+			[]OperationStatus{OperationApplied, OperationFailed, OperationSkipped},
+		},
+		{
+			`{"a": [1, 2], "b": 2}`,
+			`[
+				{"op": "move", "from": "/a/0", "path": "/c/d"},
+				{"op": "test", "path": "/b", "value": 3},
+				{"op": "add", "path": "/a/-", "value": 3}
+			]`,
+			`{"a": [1, 2, 3], "b": 2}`,
+			true,
+			[]OperationStatus{OperationFailed, OperationFailed, OperationApplied},
+		},
+		{
+			`[]`,
+			`[
+				{"op": "add", "path": "/0", "value": null},
+				{"op": "test", "path": "/0", "value": "x"}
+			]`,
+			`[null]`,
+			true,
+			[]OperationStatus{OperationApplied, OperationFailed},
+		},
+	}
+
+	for _, c := range cases {
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		options := NewApplyOptions()
+		options.ContinueOnError = c.continueOnError
+
+		out, results, err := p.ApplyWithResults([]byte(c.doc), options)
+
+		if c.continueOnError {
+			if err != nil {
+				t.Fatalf("Unable to apply patch %s: %s", c.patch, err)
+			}
+
+			if !compareJSON(string(out), c.result) {
+				t.Errorf("Applying %s: expected %s, got %s", c.patch, reformatJSON(c.result), reformatJSON(string(out)))
+			}
+		} else if err == nil || out != nil {
+			t.Errorf("Applying %s: expected an error and no document, got %s", c.patch, out)
+		}
+
+		statuses := make([]OperationStatus, len(results))
+		for i, r := range results {
+			statuses[i] = r.Status
+
+			if (r.Status == OperationFailed) != (r.Err != nil) {
+				t.Errorf("Applying %s: operation %d is %s with error %v", c.patch, i, r.Status, r.Err)
+			}
+		}
+
+		if !reflect.DeepEqual(statuses, c.statuses) {
+			t.Errorf("Applying %s: expected statuses %v, got %v", c.patch, c.statuses, statuses)
+		}
+	}
+}
+
+func TestApplyWithResultsCopySizeLimit(t *testing.T) {
+	p, _ := DecodePatch([]byte(`[
+		{"op": "copy", "from": "/big", "path": "/c"},
+		{"op": "copy", "from": "/small", "path": "/d"}
+	]`))
+
+	options := NewApplyOptions()
+	options.ContinueOnError = true
+	options.AccumulatedCopySizeLimit = 10
+
+	out, results, err := p.ApplyWithResults([]byte(`{"big": "aaaaaaaaaaaaaaaaaaaa", "small": 1}`), options)
+	if err != nil {
+		t.Fatalf("Unable to apply patch: %s", err)
+	}
+
+	var sizeErr *AccumulatedCopySizeError
+	if !errors.As(results[0].Err, &sizeErr) {
+		t.Errorf("Expected the first copy to exceed the limit, got %v", results[0].Err)
+	}
+
+	if results[1].Status != OperationApplied {
+		t.Errorf("Expected the second copy to apply, got %s: %v", results[1].Status, results[1].Err)
+	}
+
+	if !compareJSON(string(out), `{"big": "aaaaaaaaaaaaaaaaaaaa", "small": 1, "d": 1}`) {
+		t.Errorf("Unexpected document %s", out)
+	}
+}
+
+func TestApplyWithResultsFailedOperationsLeaveDocument(t *testing.T) {
+	p, _ := DecodePatch([]byte(`[
+		{"op": "move", "from": "/a", "path": "/missing/b"},
+		{"op": "move", "from": "/c/0", "path": "/c/9"},
+		{"op": "add", "path": "/d/e/-1", "value": 1},
+		{"op": "add", "path": "/c/3/-1", "value": 1},
+		{"op": "add", "path": "/c/5/x/-1", "value": 1}
+	]`))
+
+	options := NewApplyOptions()
+	options.ContinueOnError = true
+	options.EnsurePathExistsOnAdd = true
+	options.SupportNegativeIndices = false
+
+	doc := `{"a":1,"b":2,"c":[3,4]}`
+
+	out, results, err := p.ApplyWithResults([]byte(doc), options)
+	if err != nil {
+		t.Fatalf("Unable to apply patch: %s", err)
+	}
+
+	for i, r := range results {
+		if r.Status != OperationFailed {
+			t.Errorf("Expected operation %d to fail, got %s", i, r.Status)
+		}
+	}
+
+	// The members keep their order, which compareJSON ignores.
+	if string(out) != doc {
+		t.Errorf("Expected %s, got %s", doc, out)
+	}
+}
+
+func TestApplyWithResultsFailedAddLeavesEmptyArray(t *testing.T) {
+	p, _ := DecodePatch([]byte(`[{"op": "add", "path": "/x/a/b", "value": 1}]`))
+
+	options := NewApplyOptions()
+	options.ContinueOnError = true
+	options.EnsurePathExistsOnAdd = true
+
+	out, results, err := p.ApplyWithResults([]byte(`{"x": []}`), options)
+	if err != nil {
+		t.Fatalf("Unable to apply patch: %s", err)
+	}
+
+	if results[0].Status != OperationFailed {
+		t.Errorf("Expected the operation to fail, got %s", results[0].Status)
+	}
+
+	if !compareJSON(string(out), `{"x": []}`) {
+		t.Errorf("Expected the document to be left as is, got %s", out)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p, _ := DecodePatch([]byte(`[
+		{"op": "remove", "path": "/missing"},
+		{"op": "add", "path": "/a/5", "value": 1},
+		{"op": "test", "path": "/b", "value": 3},
+		{"op": "copy", "from": "/b", "path": "/c"},
+		{"op": "copy", "from": "/a", "path": "/d"},
+		{"op": "test", "path": "/c", "value": 2}
+	]`))
+
+	options := NewApplyOptions()
+	options.AccumulatedCopySizeLimit = 4
+
+	errs := p.Check([]byte(`{"a": [1, 2, 3], "b": 2}`), options)
+
+	expected := []struct {
+		index int
+		cause error
+	}{
+		{0, ErrMissing},
+		{1, ErrInvalidIndex},
+		{2, ErrTestFailed},
+		{4, &AccumulatedCopySizeError{}},
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for i, e := range expected {
+		var patchErr *PatchError
+		if !errors.As(errs[i], &patchErr) || patchErr.Index != e.index {
+			t.Errorf("Expected error %d for operation %d, got %v", i, e.index, errs[i])
+			continue
+		}
+
+		var sizeErr *AccumulatedCopySizeError
+		if errors.As(e.cause, &sizeErr) {
+			if !errors.As(errs[i], &sizeErr) {
+				t.Errorf("Expected a copy size error, got %v", errs[i])
+			}
+		} else if !errors.Is(errs[i], e.cause) {
+			t.Errorf("Expected error %d to match %v, got %v", i, e.cause, errs[i])
+		}
+	}
+
+	if errs := p[3:4].Check([]byte(`{"b": 2}`), NewApplyOptions()); errs != nil {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+}
@@ -0,0 +1,307 @@
+package jsonpatch
+
+import (
+	"errors"
+	"strings"
+)
+
+// Compose concatenates the patches and squashes the result, returning a
+// patch equivalent to applying each of the patches in succession.
+func Compose(patches ...Patch) Patch {
+	var all Patch
+
+	for _, p := range patches {
+		all = append(all, p...)
+	}
+
+	return all.Squash()
+}
+
+// Squash returns a shorter patch with the same effect as p, by combining
+// operations on the same path:
+//
+//   - "add" or "replace" followed by "replace" becomes the first kind of
+//     operation with the last value,
+//   - "add" followed by "remove" disappears if the "add" created the value,
+//     and becomes "remove" if it overwrote one,
+//   - "replace" followed by "remove" becomes "remove",
+//   - "remove" followed by "add" becomes "replace",
+//   - "add" followed by a "move" of the added value becomes an "add" at the
+//     destination, if the "add" created the value.
+//
+// Operations are only combined when no operation between them reads, changes
+// or shifts the path they share, so a "test" of that path is never skipped.
+// Operations with members other than "op", "path", "from" and "value", and
+// paths that are not plain JSON Pointers, are left as they are.
+//
+// As a patch is squashed without the document, an "add" is only known to
+// create its value when its path ends with an array index or "-"; any token
+// that looks like an array index is treated as one. SquashDocument also
+// combines the "add" operations of object members.
+func (p Patch) Squash() Patch {
+	effects := make([]addEffect, len(p))
+	for i, op := range p {
+		effects[i] = guessAddEffect(op)
+	}
+
+	return squash(p, effects)
+}
+
+// SquashDocument is like Squash, but reads doc, the document p is meant to be
+// applied to, to tell which "add" operations create their value and which
+// overwrite one. It returns an error if p does not apply to doc.
+func (p Patch) SquashDocument(doc []byte) (Patch, error) {
+	return p.SquashDocumentWithOptions(doc, NewApplyOptions())
+}
+
+// SquashDocumentWithOptions is like SquashDocument, but applies p to doc with
+// the given options.
+func (p Patch) SquashDocumentWithOptions(doc []byte, options *ApplyOptions) (Patch, error) {
+	effects := make([]addEffect, len(p))
+
+	for i, op := range p {
+		effects[i] = findAddEffect(doc, op)
+
+		var err error
+		doc, err = Patch{op}.ApplyWithOptions(doc, options)
+		if err != nil {
+			// Report the position of op in p rather than in Patch{op}.
+			var patchErr *PatchError
+			if errors.As(err, &patchErr) {
+				patchErr.Index = i
+			}
+			return nil, err
+		}
+	}
+
+	return squash(p, effects), nil
+}
+
+// addEffect tells what writing a value at the path of an "add" or the
+// destination of a "move" does to the value already there.
+type addEffect int
+
+const (
+	addMayOverwrite addEffect = iota
+	addCreates
+	addOverwrites
+)
+
+// guessAddEffect returns the effect of op that can be told from its path
+// alone.
+func guessAddEffect(op Operation) addEffect {
+	path, err := op.Path()
+	if err != nil || path == "" {
+		return addMayOverwrite
+	}
+
+	if isIndexToken(path[strings.LastIndex(path, "/")+1:]) {
+		return addCreates
+	}
+
+	return addMayOverwrite
+}
+
+// findAddEffect returns the effect of op on doc, the document it is about to
+// be applied to.
+func findAddEffect(doc []byte, op Operation) addEffect {
+	switch op.Kind() {
+	case "add":
+	case "move":
+		// The destination of a "move" is written once its source is
+		// removed.
+		from, err := op.From()
+		if err != nil || !isPlainPointer(from) {
+			return addMayOverwrite
+		}
+
+		doc, err = Patch{newOperation("remove", from)}.Apply(doc)
+		if err != nil {
+			return addMayOverwrite
+		}
+	default:
+		return addMayOverwrite
+	}
+
+	ptr, err := op.PathPointer()
+	if err != nil || ptr.IsRoot() || !isPlainPointer(ptr.String()) {
+		return addMayOverwrite
+	}
+
+	parent, err := GetPointer(doc, ptr.Parent().String())
+	if err != nil {
+		return addMayOverwrite
+	}
+
+	if isArray(parent) || !HasPointer(doc, ptr.String()) {
+		return addCreates
+	}
+
+	return addOverwrites
+}
+
+func squash(p Patch, effects []addEffect) Patch {
+	ops := make(Patch, len(p))
+	copy(ops, p)
+
+	for j := 0; j < len(ops); j++ {
+		target, err := squashTarget(ops[j])
+		if err != nil || !isPlainPointer(target) || !hasStandardMembers(ops[j]) {
+			continue
+		}
+
+		i := squashPartner(ops, j, target)
+		if i < 0 || !hasStandardMembers(ops[i]) {
+			continue
+		}
+
+		combined, effect, ok := squashPair(ops[i], ops[j], effects[i], effects[j])
+		if !ok {
+			continue
+		}
+
+		squashed := make(Patch, 0, len(ops))
+		squashedEffects := make([]addEffect, 0, len(ops))
+		squashed = append(squashed, ops[:i]...)
+		squashedEffects = append(squashedEffects, effects[:i]...)
+		squashed = append(squashed, ops[i+1:j]...)
+		squashedEffects = append(squashedEffects, effects[i+1:j]...)
+		if combined != nil {
+			squashed = append(squashed, combined)
+			squashedEffects = append(squashedEffects, effect)
+		}
+		squashed = append(squashed, ops[j+1:]...)
+		squashedEffects = append(squashedEffects, effects[j+1:]...)
+		ops, effects = squashed, squashedEffects
+
+		// The operations after i may now combine with earlier ones that
+		// the dropped operation stood between.
+		j = i - 1
+	}
+
+	return ops
+}
+
+// squashTarget returns the path through which op may combine with an earlier
+// operation: the source of a "move", and the path of anything else.
+func squashTarget(op Operation) (string, error) {
+	if op.Kind() == "move" {
+		return op.From()
+	}
+
+	return op.Path()
+}
+
+// squashPartner returns the index of the closest operation before j whose
+// path is target, provided none of the operations in between interact with
+// target, or -1. A path that is not a plain JSON Pointer may match any
+// location, so it interacts with every target.
+func squashPartner(ops Patch, j int, target string) int {
+	for i := j - 1; i >= 0; i-- {
+		path, err := ops[i].Path()
+		if err != nil || !isPlainPointer(path) {
+			return -1
+		}
+
+		if path == target {
+			return i
+		}
+
+		if pathsInteract(target, path) {
+			return -1
+		}
+
+		if from, err := ops[i].From(); err == nil && (!isPlainPointer(from) || pathsInteract(target, from)) {
+			return -1
+		}
+	}
+
+	return -1
+}
+
+// squashPair combines two operations on the same path into a single
+// operation, which takes the place of second, and returns it along with its
+// effect. A nil operation means that both operations cancel out.
+func squashPair(first, second Operation, firstEffect, secondEffect addEffect) (Operation, addEffect, bool) {
+	path, _ := first.Path()
+
+	switch first.Kind() + " " + second.Kind() {
+	case "add replace", "replace replace":
+		return newValueOperation(first.Kind(), path, operationValue(second)), firstEffect, true
+	case "add remove":
+		if path == "" || isAppendPath(path) {
+			return nil, addMayOverwrite, false
+		}
+		switch firstEffect {
+		case addCreates:
+			return nil, addMayOverwrite, true
+		case addOverwrites:
+			return second, addMayOverwrite, true
+		}
+	case "replace remove":
+		return second, addMayOverwrite, true
+	case "remove add":
+		if path == "" || isAppendPath(path) {
+			return nil, addMayOverwrite, false
+		}
+		return newValueOperation("replace", path, operationValue(second)), addMayOverwrite, true
+	case "add move":
+		to, err := second.Path()
+		if err != nil || firstEffect != addCreates || path == "" || isAppendPath(path) || isProperPathPrefix(path, to) {
+			return nil, addMayOverwrite, false
+		}
+		return newValueOperation("add", to, operationValue(first)), secondEffect, true
+	}
+
+	return nil, addMayOverwrite, false
+}
+
+// isPlainPointer reports whether path is a JSON Pointer that refers to a
+// single location, rather than a JSONPath expression, a path with wildcards
+// or a Relative JSON Pointer.
+func isPlainPointer(path string) bool {
+	if path == "" {
+		return true
+	}
+
+	if path[0] != '/' {
+		return false
+	}
+
+	for _, token := range strings.Split(path, "/") {
+		if token == "*" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasStandardMembers reports whether op has no members besides those RFC 6902
+// defines, such as the "if" of a conditional operation, which combining op
+// with another operation would lose.
+func hasStandardMembers(op Operation) bool {
+	for name := range op {
+		switch name {
+		case "op", "path", "from", "value":
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// isAppendPath reports whether path refers to the end of an array, in which
+// case two operations on it do not refer to the same element.
+func isAppendPath(path string) bool {
+	return strings.HasSuffix(path, "/-")
+}
+
+func operationValue(op Operation) []byte {
+	if raw := op["value"]; raw != nil {
+		return *raw
+	}
+
+	return rawJSONNull
+}
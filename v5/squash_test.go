@@ -0,0 +1,325 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// SquashCases hold the result of Squash, and that of SquashDocument when it
+// differs.
+var SquashCases = []struct {
+	name, doc, patch, squashed, withDoc string
+}{
+	{
+		"add then remove",
+		`{"a": 1}`,
+		`[{"op": "add", "path": "/b", "value": 2}, {"op": "remove", "path": "/b"}]`,
+		`[{"op": "add", "path": "/b", "value": 2}, {"op": "remove", "path": "/b"}]`,
+		`[]`,
+	},
+	{
+		"overwriting add then remove",
+		`{"b": [1]}`,
+		`[{"op": "add", "path": "/b", "value": 5}, {"op": "remove", "path": "/b"}]`,
+		`[{"op": "add", "path": "/b", "value": 5}, {"op": "remove", "path": "/b"}]`,
+		`[{"op": "remove", "path": "/b"}]`,
+	},
+	{
+		"add then remove in array",
+		`{"a": [1]}`,
+		`[{"op": "add", "path": "/a/0", "value": 2}, {"op": "remove", "path": "/a/0"}]`,
+		`[]`,
+		``,
+	},
+	{
+		"replace then replace",
+		`{"a": 1}`,
+		`[{"op": "replace", "path": "/a", "value": 2}, {"op": "replace", "path": "/a", "value": 3}]`,
+		`[{"op": "replace", "path": "/a", "value": 3}]`,
+		``,
+	},
+	{
+		"add then replace",
+		`{"a": [1, 2]}`,
+		`[{"op": "add", "path": "/a/1", "value": 3}, {"op": "replace", "path": "/a/1", "value": null}]`,
+		`[{"op": "add", "path": "/a/1", "value": null}]`,
+		``,
+	},
+	{
+		"replace then remove",
+		`{"a": 1}`,
+		`[{"op": "replace", "path": "/a", "value": 2}, {"op": "remove", "path": "/a"}]`,
+		`[{"op": "remove", "path": "/a"}]`,
+		``,
+	},
+	{
+		"remove then add",
+		`{"a": [1, 2, 3]}`,
+		`[{"op": "remove", "path": "/a/1"}, {"op": "add", "path": "/a/1", "value": 4}]`,
+		`[{"op": "replace", "path": "/a/1", "value": 4}]`,
+		``,
+	},
+	{
+		"add then move",
+		`{"a": [1, 2, 3]}`,
+		`[{"op": "add", "path": "/a/0", "value": 4}, {"op": "move", "from": "/a/0", "path": "/a/2"}]`,
+		`[{"op": "add", "path": "/a/2", "value": 4}]`,
+		``,
+	},
+	{
+		"cascade",
+		`{"a": 1}`,
+		`[
+			{"op": "add", "path": "/b", "value": 2},
+			{"op": "replace", "path": "/b", "value": 3},
+			{"op": "move", "from": "/b", "path": "/c"},
+			{"op": "replace", "path": "/c", "value": 4}
+		]`,
+		`[
+			{"op": "add", "path": "/b", "value": 3},
+			{"op": "move", "from": "/b", "path": "/c"},
+			{"op": "replace", "path": "/c", "value": 4}
+		]`,
+		`[{"op": "add", "path": "/c", "value": 4}]`,
+	},
+	{
+		"overwriting add then move",
+		`{"a": 1, "b": 2}`,
+		`[{"op": "add", "path": "/a", "value": 3}, {"op": "move", "from": "/a", "path": "/b"}]`,
+		`[{"op": "add", "path": "/a", "value": 3}, {"op": "move", "from": "/a", "path": "/b"}]`,
+		``,
+	},
+	{
+		"JSONPath in between",
+		`{"a": {"b": 1}}`,
+		`[
+			{"op": "replace", "path": "/a/b", "value": 2},
+			{"op": "test", "path": "$..b", "value": 2},
+			{"op": "replace", "path": "/a/b", "value": 3}
+		]`,
+		`[
+			{"op": "replace", "path": "/a/b", "value": 2},
+			{"op": "test", "path": "$..b", "value": 2},
+			{"op": "replace", "path": "/a/b", "value": 3}
+		]`,
+		``,
+	},
+	{
+		"conditional operation",
+		`{"a": 1}`,
+		`[
+			{"op": "replace", "path": "/a", "value": 2},
+			{"op": "replace", "path": "/a", "value": 3, "if": {"path": "/a", "value": 1}}
+		]`,
+		`[
+			{"op": "replace", "path": "/a", "value": 2},
+			{"op": "replace", "path": "/a", "value": 3, "if": {"path": "/a", "value": 1}}
+		]`,
+		``,
+	},
+	{
+		"unrelated operations in between",
+		`{"a": 1, "b": [1]}`,
+		`[
+			{"op": "replace", "path": "/a", "value": 2},
+			{"op": "add", "path": "/b/0", "value": 0},
+			{"op": "replace", "path": "/a", "value": 3}
+		]`,
+		`[{"op": "add", "path": "/b/0", "value": 0}, {"op": "replace", "path": "/a", "value": 3}]`,
+		``,
+	},
+	{
+		"test in between",
+		`{"a": 1}`,
+		`[
+			{"op": "replace", "path": "/a", "value": 2},
+			{"op": "test", "path": "/a", "value": 2},
+			{"op": "replace", "path": "/a", "value": 3}
+		]`,
+		`[
+			{"op": "replace", "path": "/a", "value": 2},
+			{"op": "test", "path": "/a", "value": 2},
+			{"op": "replace", "path": "/a", "value": 3}
+		]`,
+		``,
+	},
+	{
+		"shifting operation in between",
+		`{"a": [1, 2, 3]}`,
+		`[
+			{"op": "add", "path": "/a/1", "value": 4},
+			{"op": "remove", "path": "/a/0"},
+			{"op": "remove", "path": "/a/1"}
+		]`,
+		`[
+			{"op": "add", "path": "/a/1", "value": 4},
+			{"op": "remove", "path": "/a/0"},
+			{"op": "remove", "path": "/a/1"}
+		]`,
+		``,
+	},
+	{
+		"parent replaced in between",
+		`{"a": {"b": 1}}`,
+		`[
+			{"op": "replace", "path": "/a/b", "value": 2},
+			{"op": "replace", "path": "/a", "value": {"b": 5}},
+			{"op": "replace", "path": "/a/b", "value": 3}
+		]`,
+		`[
+			{"op": "replace", "path": "/a/b", "value": 2},
+			{"op": "replace", "path": "/a", "value": {"b": 5}},
+			{"op": "replace", "path": "/a/b", "value": 3}
+		]`,
+		``,
+	},
+	{
+		"append",
+		`{"a": [1]}`,
+		`[{"op": "add", "path": "/a/-", "value": 2}, {"op": "add", "path": "/a/-", "value": 3}]`,
+		`[{"op": "add", "path": "/a/-", "value": 2}, {"op": "add", "path": "/a/-", "value": 3}]`,
+		``,
+	},
+}
+
+func TestSquash(t *testing.T) {
+	options := NewApplyOptions()
+	options.AllowJSONPath = true
+	options.ConditionalOperations = true
+
+	for _, c := range SquashCases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := DecodePatch([]byte(c.patch))
+			if err != nil {
+				t.Fatalf("Unable to decode patch: %s", err)
+			}
+
+			withDoc, err := p.SquashDocumentWithOptions([]byte(c.doc), options)
+			if err != nil {
+				t.Fatalf("Unable to squash patch against the document: %s", err)
+			}
+
+			expectedWithDoc := c.withDoc
+			if expectedWithDoc == "" {
+				expectedWithDoc = c.squashed
+			}
+
+			for _, s := range []struct {
+				squashed Patch
+				expected string
+			}{
+				{p.Squash(), c.squashed},
+				{withDoc, expectedWithDoc},
+			} {
+				out, err := json.Marshal(s.squashed)
+				if err != nil {
+					t.Fatalf("Unable to marshal squashed patch: %s", err)
+				}
+
+				if !compareJSON(string(out), s.expected) {
+					t.Errorf("Unexpected squashed patch. Expected:\n%s\n\nActual:\n%s", s.expected, out)
+				}
+
+				expected, err := p.ApplyWithOptions([]byte(c.doc), options)
+				if err != nil {
+					t.Fatalf("Unable to apply patch: %s", err)
+				}
+
+				actual, err := s.squashed.ApplyWithOptions([]byte(c.doc), options)
+				if err != nil {
+					t.Fatalf("Unable to apply squashed patch: %s", err)
+				}
+
+				if !compareJSON(string(actual), string(expected)) {
+					t.Errorf("Squashed patch is not equivalent. Expected:\n%s\n\nActual:\n%s", expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestSquashEquivalent(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		doc, err := json.Marshal(map[string]interface{}{"a": randomValue(r, 3), "b": randomValue(r, 2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw := randomPatch(r, doc, 2+r.Intn(5))
+
+		p, err := DecodePatch([]byte(raw))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", raw, err)
+		}
+
+		expected, err := p.Apply(doc)
+		if err != nil {
+			t.Fatalf("Unable to apply patch %s: %s", raw, err)
+		}
+
+		withDoc, err := p.SquashDocument(doc)
+		if err != nil {
+			t.Fatalf("Unable to squash patch %s against %s: %s", raw, doc, err)
+		}
+
+		for _, squashed := range []Patch{p.Squash(), withDoc} {
+			actual, err := squashed.Apply(doc)
+			if err != nil || !compareJSON(string(actual), string(expected)) {
+				out, _ := json.Marshal(squashed)
+				t.Errorf("Squashing %s on %s: expected %s, got %s (%v) from %s", raw, doc, expected, actual, err, out)
+			}
+		}
+	}
+}
+
+func TestSquashDocumentError(t *testing.T) {
+	p, _ := DecodePatch([]byte(`[{"op": "add", "path": "/a", "value": 1}, {"op": "remove", "path": "/b"}]`))
+
+	_, err := p.SquashDocument([]byte(`{}`))
+
+	var patchErr *PatchError
+	if !errors.As(err, &patchErr) || patchErr.Index != 1 || !errors.Is(err, ErrMissing) {
+		t.Errorf("Expected a PatchError for operation 1, got %v", err)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	doc := []byte(`{"name": "John", "tags": ["a"]}`)
+
+	p1, _ := DecodePatch([]byte(`[{"op": "replace", "path": "/name", "value": "Jane"}, {"op": "add", "path": "/age", "value": 1}]`))
+	p2, _ := DecodePatch([]byte(`[{"op": "replace", "path": "/age", "value": 2}, {"op": "add", "path": "/tags/-", "value": "b"}]`))
+	p3, _ := DecodePatch([]byte(`[{"op": "replace", "path": "/name", "value": "Tina"}]`))
+
+	composed := Compose(p1, p2, p3)
+
+	if len(composed) != 3 {
+		out, _ := json.Marshal(composed)
+		t.Errorf("Expected 3 operations, got %s", out)
+	}
+
+	expected := doc
+	for _, p := range []Patch{p1, p2, p3} {
+		var err error
+		expected, err = p.Apply(expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	actual, err := composed.Apply(doc)
+	if err != nil {
+		t.Fatalf("Unable to apply composed patch: %s", err)
+	}
+
+	if !compareJSON(string(actual), string(expected)) {
+		t.Errorf("Composed patch is not equivalent. Expected:\n%s\n\nActual:\n%s", expected, actual)
+	}
+
+	if len(Compose()) != 0 {
+		t.Errorf("Composing no patches should be empty")
+	}
+}
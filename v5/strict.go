@@ -0,0 +1,94 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// effective returns the options operations are applied with: o itself, or if
+// Strict is set, a copy of o with every deviation from RFC 6902 turned off.
+func (o *ApplyOptions) effective() *ApplyOptions {
+	if !o.Strict {
+		return o
+	}
+
+	strict := *o
+	strict.SupportNegativeIndices = false
+	strict.AllowMissingPathOnRemove = false
+	strict.EnsurePathExistsOnAdd = false
+	strict.AllowRelativeFrom = false
+	strict.AllowJSONPath = false
+	strict.AllowWildcards = false
+	strict.CustomOperations = nil
+	strict.ExtendedTests = false
+	strict.ConditionalOperations = false
+
+	return &strict
+}
+
+// parseIndex decodes the reference token key as an array index. If options
+// set Strict, key must follow the array-index syntax of RFC 6901, which has
+// no sign and no leading zeros.
+func parseIndex(key string, options *ApplyOptions) (int, error) {
+	if options.Strict && !isArrayIndex(key) {
+		return 0, fmt.Errorf("invalid array index: '%s': %w", key, ErrInvalidIndex)
+	}
+
+	return strconv.Atoi(key)
+}
+
+// isArrayIndex reports whether s is "0" or digits not starting with "0".
+func isArrayIndex(s string) bool {
+	if s == "0" {
+		return true
+	}
+
+	return s != "" && s[0] != '0' && leadingDigits(s) == len(s)
+}
+
+// checkDuplicateMembers returns an error if an operation of the patch in buf
+// has two members of the same name, which decoding it would silently drop.
+func checkDuplicateMembers(buf []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return err
+	}
+
+	for i := 0; dec.More(); i++ {
+		if tok, err := dec.Token(); err != nil {
+			return err
+		} else if tok != json.Delim('{') {
+			continue
+		}
+
+		seen := map[string]bool{}
+
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+
+			name, _ := tok.(string)
+			if seen[name] {
+				return fmt.Errorf("operation %d has more than one '%s' member: %w", i, name, ErrInvalid)
+			}
+			seen[name] = true
+
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return err
+			}
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
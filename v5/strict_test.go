@@ -0,0 +1,131 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+func strictOptions() *ApplyOptions {
+	options := NewApplyOptions()
+	options.Strict = true
+	return options
+}
+
+func TestStrictRejects(t *testing.T) {
+	cases := []struct {
+		doc, patch string
+		err        error
+	}{
+		{`{"a": [1, 2]}`, `[{"op": "remove", "path": "/a/-1"}]`, ErrInvalidIndex},
+		{`{"a": [1, 2]}`, `[{"op": "replace", "path": "/a/01", "value": 3}]`, ErrMissing},
+		{`{"a": [1, 2]}`, `[{"op": "add", "path": "/a/+1", "value": 3}]`, ErrInvalidIndex},
+		{`{"a": [1, 2]}`, `[{"op": "test", "path": "/a/00", "value": 1}]`, ErrInvalidIndex},
+		{`{"a": [1, 2]}`, `[{"op": "copy", "from": "/a/-2", "path": "/b"}]`, ErrInvalidIndex},
+		{`{"a": null}`, `[{"op": "test", "path": "/b", "value": null}]`, ErrMissing},
+		{`{"a": null}`, `[{"op": "test", "path": "/a"}]`, ErrMissing},
+		{`{}`, `[{"op": "remove", "path": "/a"}]`, ErrMissing},
+		{`{}`, `[{"op": "add", "path": "/a/b", "value": 1}]`, ErrMissing},
+		{`{"a": 1}`, `[{"op": "test", "path": "/", "value": {"a": 1}}]`, ErrMissing},
+		{`[1]`, `[{"op": "test", "path": "/", "value": [1]}]`, ErrInvalidIndex},
+	}
+
+	options := strictOptions()
+	options.SupportNegativeIndices = true
+	options.AllowMissingPathOnRemove = true
+	options.EnsurePathExistsOnAdd = true
+
+	for _, c := range cases {
+		lenient, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		if _, err := lenient.ApplyWithOptions([]byte(c.doc), options); !errors.Is(err, c.err) {
+			t.Errorf("Applying %s: expected %v, got %v", c.patch, c.err, err)
+		}
+	}
+}
+
+func TestStrictAccepts(t *testing.T) {
+	cases := []struct {
+		doc, patch, result string
+	}{
+		{`{"a": [1, 2]}`, `[{"op": "replace", "path": "/a/0", "value": 3}]`, `{"a": [3, 2]}`},
+		{`{"a": [1, 2]}`, `[{"op": "add", "path": "/a/-", "value": 3}]`, `{"a": [1, 2, 3]}`},
+		{`{"a": [1, 2]}`, `[{"op": "remove", "path": "/a/1"}]`, `{"a": [1]}`},
+		{`{"a": null}`, `[{"op": "test", "path": "/a", "value": null}]`, `{"a": null}`},
+		{`{"01": 1}`, `[{"op": "remove", "path": "/01"}]`, `{}`},
+		{`{"a": 1}`, `[{"op": "add", "path": "/b", "value": 2, "spurious": true}]`, `{"a": 1, "b": 2}`},
+		{`{"": 1, "a": 2}`, `[{"op": "test", "path": "/", "value": 1}]`, `{"": 1, "a": 2}`},
+		{`{"": {"": 1}}`, `[{"op": "replace", "path": "//", "value": 2}]`, `{"": {"": 2}}`},
+		{`{"": 1}`, `[{"op": "copy", "from": "/", "path": "/a"}]`, `{"": 1, "a": 1}`},
+		{`{"a": 1}`, `[{"op": "add", "path": "/b", "value": 2}, {"op": "copy", "from": "", "path": "/c"}]`, `{"a": 1, "b": 2, "c": {"a": 1, "b": 2}}`},
+		{`{"a": 1}`, `[{"op": "test", "path": "", "value": {"a": 1}}]`, `{"a": 1}`},
+	}
+
+	options := strictOptions()
+
+	for _, c := range cases {
+		p, err := DecodePatchWithOptions([]byte(c.patch), options)
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		out, err := p.ApplyWithOptions([]byte(c.doc), options)
+		if err != nil {
+			t.Errorf("Unable to apply %s: %s", c.patch, err)
+			continue
+		}
+
+		if !compareJSON(string(out), c.result) {
+			t.Errorf("Applying %s: expected %s, got %s", c.patch, c.result, out)
+		}
+	}
+}
+
+func TestStrictDecode(t *testing.T) {
+	options := strictOptions()
+
+	for _, patch := range []string{
+		`[{"op": "add", "path": "/a", "value": 1, "op": "remove"}]`,
+		`[{"op": "test", "path": "/a", "path": "/b", "value": 1}]`,
+		`[{"op": "test", "path": "/a"}]`,
+	} {
+		if _, err := DecodePatch([]byte(patch)); err != nil {
+			t.Errorf("Expected %s to be accepted without Strict: %s", patch, err)
+		}
+
+		if _, err := DecodePatchWithOptions([]byte(patch), options); err == nil {
+			t.Errorf("Expected %s to be rejected", patch)
+		}
+	}
+
+	options.RegisterOperation("noop", func(op Operation, target *OperationTarget) error { return nil })
+
+	if _, err := DecodePatchWithOptions([]byte(`[{"op": "noop", "path": "/a"}]`), options); err == nil {
+		t.Errorf("Expected a custom operation to be rejected")
+	}
+}
+
+func TestStrictDisablesExtensions(t *testing.T) {
+	options := strictOptions()
+	options.AllowWildcards = true
+	options.ConditionalOperations = true
+
+	p := Patch{newOperation("remove", "/*")}
+	if _, err := p.ApplyWithOptions([]byte(`{"a": 1}`), options); !errors.Is(err, ErrMissing) {
+		t.Errorf("Expected the wildcard to be taken literally, got %v", err)
+	}
+
+	patch := `[{"op": "remove", "path": "/a", "if": {"path": "/a", "value": 2}}]`
+
+	p, err := DecodePatchWithOptions([]byte(patch), options)
+	if err != nil {
+		t.Fatalf("Unable to decode patch %s: %s", patch, err)
+	}
+
+	out, err := p.ApplyWithOptions([]byte(`{"a": 1}`), options)
+	if err != nil || !compareJSON(string(out), `{}`) {
+		t.Errorf("Expected the 'if' member to be ignored, got %s: %v", out, err)
+	}
+}
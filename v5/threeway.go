@@ -0,0 +1,341 @@
+package jsonpatch
+
+import (
+	"strconv"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// Conflict describes a location that ours and theirs changed in different
+// ways during a three-way merge.
+type Conflict struct {
+	// Path is the JSON Pointer of the location in the merged document.
+	Path string
+	// Base, Ours and Theirs hold the value at Path in each document, or nil
+	// when the location does not exist in that document.
+	Base   json.RawMessage
+	Ours   json.RawMessage
+	Theirs json.RawMessage
+}
+
+// ThreeWayMerge merges the changes that ours and theirs made to base. Changes
+// made by one side only, or made identically by both, end up in the merged
+// document. A location both sides changed differently, including one side
+// removing a value the other changed, is reported as a Conflict and keeps the
+// value from ours.
+//
+// Objects are merged member by member. Arrays are aligned on the elements
+// neither side changed, and the elements in between are merged one by one if
+// both sides kept their number, otherwise the whole array is a conflict.
+func ThreeWayMerge(base, ours, theirs []byte) ([]byte, []Conflict, error) {
+	return ThreeWayMergeWithOptions(base, ours, theirs, NewApplyOptions())
+}
+
+// ThreeWayMergeWithOptions merges the changes that ours and theirs made to
+// base as ThreeWayMerge does, encoding the merged document and the values of
+// the conflicts according to options.
+func ThreeWayMergeWithOptions(base, ours, theirs []byte, options *ApplyOptions) ([]byte, []Conflict, error) {
+	if !json.Valid(base) || !json.Valid(ours) || !json.Valid(theirs) {
+		return nil, nil, ErrBadJSONDoc
+	}
+
+	m := &threeWayMerger{options: options}
+
+	merged, err := m.merge("",
+		mergeSide{node: newLazyNode(newRawMessage(base)), present: true},
+		mergeSide{node: newLazyNode(newRawMessage(ours)), present: true},
+		mergeSide{node: newLazyNode(newRawMessage(theirs)), present: true},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := json.MarshalEscaped(merged.node, m.options.EscapeHTML)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, m.conflicts, nil
+}
+
+// mergeSide is the value at a location in one of the merged documents. A nil
+// node that is present is a JSON null.
+type mergeSide struct {
+	node    *lazyNode
+	present bool
+}
+
+type threeWayMerger struct {
+	conflicts []Conflict
+	options   *ApplyOptions
+}
+
+func (m *threeWayMerger) merge(path string, base, ours, theirs mergeSide) (mergeSide, error) {
+	if same, err := sameSide(ours, theirs); same || err != nil {
+		return ours, err
+	}
+
+	if same, err := sameSide(base, ours); same || err != nil {
+		return theirs, err
+	}
+
+	if same, err := sameSide(base, theirs); same || err != nil {
+		return ours, err
+	}
+
+	if ours.present && theirs.present {
+		ok, tk := nodeKind(ours.node), nodeKind(theirs.node)
+
+		switch {
+		case ok == kindObject && tk == kindObject:
+			return m.mergeObjects(path, base, ours, theirs)
+		case ok == kindArray && tk == kindArray && base.present && nodeKind(base.node) == kindArray:
+			return m.mergeArrays(path, base, ours, theirs)
+		}
+	}
+
+	return ours, m.conflict(path, base, ours, theirs)
+}
+
+// mergeObjects merges the members of ours and theirs. A base that is not an
+// object, as when both sides replaced a value with an object, counts as an
+// empty one.
+func (m *threeWayMerger) mergeObjects(path string, base, ours, theirs mergeSide) (mergeSide, error) {
+	var bd *partialDoc
+
+	if base.present && nodeKind(base.node) == kindObject {
+		var err error
+		if bd, err = base.node.intoDoc(m.options); err != nil {
+			return mergeSide{}, err
+		}
+	}
+
+	od, err := ours.node.intoDoc(m.options)
+	if err != nil {
+		return mergeSide{}, err
+	}
+
+	td, err := theirs.node.intoDoc(m.options)
+	if err != nil {
+		return mergeSide{}, err
+	}
+
+	keys := append([]string{}, od.keys...)
+	for _, k := range td.keys {
+		if _, ok := od.obj[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	result := &partialDoc{obj: make(map[string]*lazyNode, len(keys)), opts: m.options}
+
+	for _, k := range keys {
+		merged, err := m.merge(path+"/"+encodePatchKey(k), memberSide(bd, k), memberSide(od, k), memberSide(td, k))
+		if err != nil {
+			return mergeSide{}, err
+		}
+
+		if merged.present {
+			result.keys = append(result.keys, k)
+			result.obj[k] = merged.node
+		}
+	}
+
+	return mergeSide{node: &lazyNode{doc: result, which: eDoc}, present: true}, nil
+}
+
+func memberSide(doc *partialDoc, key string) mergeSide {
+	if doc == nil {
+		return mergeSide{}
+	}
+
+	n, ok := doc.obj[key]
+	return mergeSide{node: n, present: ok}
+}
+
+// mergeArrays aligns the arrays on the elements of base that both sides kept,
+// and merges the runs of elements in between.
+func (m *threeWayMerger) mergeArrays(path string, base, ours, theirs mergeSide) (mergeSide, error) {
+	ba, err := base.node.intoAry()
+	if err != nil {
+		return mergeSide{}, err
+	}
+
+	oa, err := ours.node.intoAry()
+	if err != nil {
+		return mergeSide{}, err
+	}
+
+	ta, err := theirs.node.intoAry()
+	if err != nil {
+		return mergeSide{}, err
+	}
+
+	bk, err := canonicalKeys(ba.nodes)
+	if err != nil {
+		return mergeSide{}, err
+	}
+
+	ok, err := canonicalKeys(oa.nodes)
+	if err != nil {
+		return mergeSide{}, err
+	}
+
+	tk, err := canonicalKeys(ta.nodes)
+	if err != nil {
+		return mergeSide{}, err
+	}
+
+	ourMatch, theirMatch := lcsMatches(bk, ok), lcsMatches(bk, tk)
+
+	// Conflicts within the elements are dropped in favour of one for the
+	// whole array if the array cannot be merged.
+	conflicts := len(m.conflicts)
+
+	var result []*lazyNode
+	bi, oi, ti := 0, 0, 0
+
+	for i := 0; i <= len(ba.nodes); i++ {
+		oEnd, tEnd := len(oa.nodes), len(ta.nodes)
+		if i < len(ba.nodes) {
+			if ourMatch[i] < 0 || theirMatch[i] < 0 {
+				continue
+			}
+			oEnd, tEnd = ourMatch[i], theirMatch[i]
+		}
+
+		bRun, oRun, tRun := bk[bi:i], ok[oi:oEnd], tk[ti:tEnd]
+
+		switch {
+		case equalStrings(oRun, bRun):
+			result = append(result, ta.nodes[ti:tEnd]...)
+		case equalStrings(tRun, bRun), equalStrings(oRun, tRun):
+			result = append(result, oa.nodes[oi:oEnd]...)
+		case len(oRun) == len(bRun) && len(tRun) == len(bRun):
+			for j := range bRun {
+				child := path + "/" + strconv.Itoa(len(result))
+
+				merged, err := m.merge(child,
+					mergeSide{node: ba.nodes[bi+j], present: true},
+					mergeSide{node: oa.nodes[oi+j], present: true},
+					mergeSide{node: ta.nodes[ti+j], present: true},
+				)
+				if err != nil {
+					return mergeSide{}, err
+				}
+
+				result = append(result, merged.node)
+			}
+		default:
+			m.conflicts = m.conflicts[:conflicts]
+			return ours, m.conflict(path, base, ours, theirs)
+		}
+
+		if i < len(ba.nodes) {
+			result = append(result, oa.nodes[oEnd])
+		}
+
+		bi, oi, ti = i+1, oEnd+1, tEnd+1
+	}
+
+	return mergeSide{node: &lazyNode{ary: &partialArray{nodes: result}, which: eAry}, present: true}, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lcsMatches returns, for every element of a, the index of the element of b
+// it is paired with in their longest common subsequence, or -1.
+func lcsMatches(a, b []string) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		matches[start] = start
+		start++
+	}
+
+	endA, endB := len(a), len(b)
+	for endA > start && endB > start && a[endA-1] == b[endB-1] {
+		endA--
+		endB--
+		matches[endA] = endB
+	}
+
+	ma, mb := a[start:endA], b[start:endB]
+	if len(ma)*len(mb) > lcsMaxCells {
+		return matches
+	}
+
+	lcs := lcsTable(ma, mb)
+	width := len(mb) + 1
+
+	for i, j := 0, 0; i < len(ma) && j < len(mb); {
+		switch {
+		case ma[i] == mb[j]:
+			matches[start+i] = start + j
+			i++
+			j++
+		case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return matches
+}
+
+func sameSide(a, b mergeSide) (bool, error) {
+	if !a.present || !b.present {
+		return a.present == b.present, nil
+	}
+
+	ak, err := canonicalKey(a.node)
+	if err != nil {
+		return false, err
+	}
+
+	bk, err := canonicalKey(b.node)
+	if err != nil {
+		return false, err
+	}
+
+	return ak == bk, nil
+}
+
+func (m *threeWayMerger) conflict(path string, base, ours, theirs mergeSide) error {
+	c := Conflict{Path: path}
+
+	for _, s := range []struct {
+		side mergeSide
+		into *json.RawMessage
+	}{{base, &c.Base}, {ours, &c.Ours}, {theirs, &c.Theirs}} {
+		if !s.side.present {
+			continue
+		}
+
+		buf, err := json.MarshalEscaped(s.side.node, m.options.EscapeHTML)
+		if err != nil {
+			return err
+		}
+		*s.into = buf
+	}
+
+	m.conflicts = append(m.conflicts, c)
+	return nil
+}
@@ -0,0 +1,199 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var ThreeWayMergeCases = []struct {
+	base, ours, theirs, result string
+	conflicts                  []string
+}{
+	{
+		`{"a": 1, "b": 2}`,
+		`{"a": 3, "b": 2}`,
+		`{"a": 1, "b": 4}`,
+		`{"a": 3, "b": 4}`,
+		nil,
+	},
+	{
+		`{"a": 1}`,
+		`{"a": 1, "b": 2}`,
+		`{"a": 1, "c": 3}`,
+		`{"a": 1, "b": 2, "c": 3}`,
+		nil,
+	},
+	{
+		`{"a": 1, "b": 2}`,
+		`{"b": 2}`,
+		`{"a": 1}`,
+		`{}`,
+		nil,
+	},
+	{
+		`{"a": 1}`,
+		`{"a": 2}`,
+		`{"a": 2}`,
+		`{"a": 2}`,
+		nil,
+	},
+	{
+		`{"a": 1}`,
+		`{"a": 2}`,
+		`{"a": 3}`,
+		`{"a": 2}`,
+		[]string{"/a"},
+	},
+	{
+		`{"a": {"b": 1, "c": 2}}`,
+		`{"a": {"b": 3, "c": 2}}`,
+		`{}`,
+		`{"a": {"b": 3, "c": 2}}`,
+		[]string{"/a"},
+	},
+	{
+		`{"a": {"b": 1}}`,
+		`{}`,
+		`{"a": {"b": 1, "c": 2}}`,
+		`{}`,
+		[]string{"/a"},
+	},
+	{
+		`{}`,
+		`{"a": {"b": 1}}`,
+		`{"a": {"c": 2}}`,
+		`{"a": {"b": 1, "c": 2}}`,
+		nil,
+	},
+	{
+		`{"a": null}`,
+		`{"a": null, "b": 1}`,
+		`{}`,
+		`{"b": 1}`,
+		nil,
+	},
+	{
+		`{"a": [1, 2, 3]}`,
+		`{"a": [0, 1, 2, 3]}`,
+		`{"a": [1, 2, 3, 4]}`,
+		`{"a": [0, 1, 2, 3, 4]}`,
+		nil,
+	},
+	{
+		`{"a": [1, 2, 3]}`,
+		`{"a": [1, 3]}`,
+		`{"a": [1, 2, 3, 4]}`,
+		`{"a": [1, 3, 4]}`,
+		nil,
+	},
+	{
+		`{"a": [{"b": 1, "c": 1}, 2]}`,
+		`{"a": [{"b": 2, "c": 1}, 2]}`,
+		`{"a": [{"b": 1, "c": 2}, 2, 3]}`,
+		`{"a": [{"b": 2, "c": 2}, 2, 3]}`,
+		nil,
+	},
+	{
+		`{"a": [1, 2], "b": 1}`,
+		`{"a": [1, 3], "b": 2}`,
+		`{"a": [1, 4, 5], "b": 1}`,
+		`{"a": [1, 3], "b": 2}`,
+		[]string{"/a"},
+	},
+	{
+		`{"a": [{"b": 1}, 2]}`,
+		`{"a": [{"b": 2}, 3]}`,
+		`{"a": [{"b": 3}, 4, 5]}`,
+		`{"a": [{"b": 2}, 3]}`,
+		[]string{"/a"},
+	},
+	{
+		`[1, {"a": 1}]`,
+		`[1, {"a": 2}]`,
+		`[1, {"a": 3}]`,
+		`[1, {"a": 2}]`,
+		[]string{"/1/a"},
+	},
+	{
+		`1`,
+		`{"a": 1}`,
+		`[1]`,
+		`{"a": 1}`,
+		[]string{""},
+	},
+}
+
+func TestThreeWayMerge(t *testing.T) {
+	for _, c := range ThreeWayMergeCases {
+		out, conflicts, err := ThreeWayMerge([]byte(c.base), []byte(c.ours), []byte(c.theirs))
+		if err != nil {
+			t.Fatalf("Unable to merge %s and %s into %s: %s", c.ours, c.theirs, c.base, err)
+		}
+
+		if !compareJSON(string(out), c.result) {
+			t.Errorf("Merging %s and %s into %s: expected %s, got %s", c.ours, c.theirs, c.base, reformatJSON(c.result), reformatJSON(string(out)))
+		}
+
+		var paths []string
+		for _, conflict := range conflicts {
+			paths = append(paths, conflict.Path)
+		}
+
+		if !reflect.DeepEqual(paths, c.conflicts) {
+			t.Errorf("Merging %s and %s into %s: expected conflicts %q, got %q", c.ours, c.theirs, c.base, c.conflicts, paths)
+		}
+	}
+}
+
+func TestThreeWayMergeConflictValues(t *testing.T) {
+	_, conflicts, err := ThreeWayMerge([]byte(`{"a": {"b": 1}}`), []byte(`{}`), []byte(`{"a": {"b": 2}}`))
+	if err != nil {
+		t.Fatalf("Unable to merge: %s", err)
+	}
+
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected a single conflict, got %d", len(conflicts))
+	}
+
+	c := conflicts[0]
+
+	if c.Path != "/a" || !compareJSON(string(c.Base), `{"b": 1}`) || c.Ours != nil || !compareJSON(string(c.Theirs), `{"b": 2}`) {
+		t.Errorf("Unexpected conflict: %s %s %s %s", c.Path, c.Base, c.Ours, c.Theirs)
+	}
+}
+
+func TestThreeWayMergeBadJSON(t *testing.T) {
+	_, _, err := ThreeWayMerge([]byte(`{}`), []byte(`{`), []byte(`{}`))
+	if !errors.Is(err, ErrBadJSONDoc) {
+		t.Errorf("Expected ErrBadJSONDoc, got %v", err)
+	}
+}
+
+func TestThreeWayMergeWithOptions(t *testing.T) {
+	base := []byte(`{"a": "<b>", "c": 1}`)
+	ours := []byte(`{"a": "<i>", "c": 2}`)
+	theirs := []byte(`{"a": "<u>", "c": 2}`)
+
+	for _, escape := range []bool{true, false} {
+		options := NewApplyOptions()
+		options.EscapeHTML = escape
+
+		out, conflicts, err := ThreeWayMergeWithOptions(base, ours, theirs, options)
+		if err != nil {
+			t.Fatalf("Unable to merge: %s", err)
+		}
+
+		if len(conflicts) != 1 {
+			t.Fatalf("Expected a single conflict, got %d", len(conflicts))
+		}
+
+		values := []string{string(out), string(conflicts[0].Base), string(conflicts[0].Ours), string(conflicts[0].Theirs)}
+		for _, v := range values {
+			if strings.Contains(v, "<") == escape {
+				t.Errorf("Expected HTML escaping to be %v, got %s", escape, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,768 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// Transform rebases two patches that were created against the same document,
+// so that applying a then b2 gives the same document as applying b then a2.
+//
+// Array indices are adjusted for elements inserted or removed by the other
+// patch, and operations whose target the other patch removed are dropped.
+// A removal wins over writes to the same member, including the destination
+// of a move, and writes to a value the other patch moved follow the value.
+// When both patches write the same location, or move the same value, a wins.
+// When both insert at the same position, the elements of a come first, which
+// for concurrent appends with "-" means a2 inserts before the elements b
+// appended, using a negative index, so rebasing a2 again takes
+// TransformDocument. ErrCopyConflict is returned when one of the patches
+// changes a value the other copies.
+//
+// As there is no document, any token that looks like an array index is taken
+// to be one. Indices counted from the end of an array, such as "-1", cannot
+// be told apart from indices counted from the start without the document, so
+// Transform rejects them with ErrInvalidIndex; TransformDocument resolves
+// them first. "-" is always the end of the array.
+func Transform(a, b Patch) (Patch, Patch, error) {
+	if err := checkFromEndIndices(a); err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkFromEndIndices(b); err != nil {
+		return nil, nil, err
+	}
+
+	return transform(a, b)
+}
+
+// TransformDocument is like Transform, but reads doc, the document both
+// patches were created against, to turn the array indices they count from
+// the end into indices counted from the start.
+func TransformDocument(doc []byte, a, b Patch) (Patch, Patch, error) {
+	a, err := resolveFromEndIndices(doc, a)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err = resolveFromEndIndices(doc, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return transform(a, b)
+}
+
+func transform(a, b Patch) (Patch, Patch, error) {
+	as, err := decodeTransformOps(a)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bs, err := decodeTransformOps(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	as, bs, err = transformOps(as, bs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return transformedPatch(as), transformedPatch(bs), nil
+}
+
+// checkFromEndIndices returns an error if a path of p holds a negative array
+// index.
+func checkFromEndIndices(p Patch) error {
+	for i, op := range p {
+		for _, path := range operationPointers(op) {
+			for _, token := range strings.Split(path, "/") {
+				if isFromEndToken(token) {
+					return fmt.Errorf("operation %d refers to %s, which counts from the end of an array and needs the document to be rebased: %w", i, path, ErrInvalidIndex)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveFromEndIndices returns p with each negative array index replaced by
+// the index counted from the start of the array, as found in the document
+// the operations before it turn doc into.
+func resolveFromEndIndices(doc []byte, p Patch) (Patch, error) {
+	resolved := make(Patch, 0, len(p))
+
+	for i, op := range p {
+		op = resolveOperationIndices(doc, op)
+
+		var err error
+		doc, err = Patch{op}.Apply(doc)
+		if err != nil {
+			// Report the position of op in p rather than in Patch{op}.
+			var patchErr *PatchError
+			if errors.As(err, &patchErr) {
+				patchErr.Index = i
+			}
+			return nil, err
+		}
+
+		resolved = append(resolved, op)
+	}
+
+	return resolved, nil
+}
+
+func resolveOperationIndices(doc []byte, op Operation) Operation {
+	var resolved Operation
+
+	for i, path := range operationPointers(op) {
+		member := "path"
+		if i > 0 {
+			member = "from"
+		}
+
+		// An "add" inserts before the index, in an array one element longer.
+		insert := member == "path" && op.Kind() == "add"
+
+		tokens, err := splitPointer(path)
+		if err != nil {
+			continue
+		}
+
+		changed := false
+		for k, token := range tokens {
+			if !isFromEndToken(token) {
+				continue
+			}
+
+			parent, err := GetPointer(doc, joinPointer(tokens[:k]))
+			if err != nil || !isArray(parent) {
+				break
+			}
+
+			var elements []json.RawMessage
+			if err := json.Unmarshal(parent, &elements); err != nil {
+				break
+			}
+
+			n, _ := strconv.Atoi(token)
+			n += len(elements)
+			if insert && k == len(tokens)-1 {
+				n++
+			}
+			if n < 0 {
+				break
+			}
+
+			tokens[k] = strconv.Itoa(n)
+			changed = true
+		}
+
+		if !changed {
+			continue
+		}
+
+		if resolved == nil {
+			resolved = make(Operation, len(op))
+			for k, v := range op {
+				resolved[k] = v
+			}
+		}
+		resolved[member] = rawString(joinPointer(tokens))
+	}
+
+	if resolved == nil {
+		return op
+	}
+
+	return resolved
+}
+
+// operationPointers returns the "path" of op, followed by its "from" if it is
+// a "move" or "copy".
+func operationPointers(op Operation) []string {
+	path, err := op.Path()
+	if err != nil {
+		return nil
+	}
+
+	paths := []string{path}
+
+	if kind := op.Kind(); kind == "move" || kind == "copy" {
+		if from, err := op.From(); err == nil {
+			paths = append(paths, from)
+		}
+	}
+
+	return paths
+}
+
+// isFromEndToken reports whether token is a negative array index.
+func isFromEndToken(token string) bool {
+	return token != "-" && strings.HasPrefix(token, "-") && isIndexToken(token)
+}
+
+// transformOps returns as rebased onto bs, and bs rebased onto as.
+func transformOps(as, bs []*transformOp) ([]*transformOp, []*transformOp, error) {
+	switch {
+	case len(as) == 0 || len(bs) == 0:
+		return as, bs, nil
+	case len(as) == 1 && len(bs) == 1:
+		x, y := as[0], bs[0]
+		if copyConflict(x, y) || copyConflict(y, x) {
+			return nil, nil, fmt.Errorf("%s at %s and %s at %s: %w", x.kind, joinPointer(x.path), y.kind, joinPointer(y.path), ErrCopyConflict)
+		}
+		return rebaseOp(x, y, true), rebaseOp(y, x, false), nil
+	case len(as) > 1:
+		a1, b1, err := transformOps(as[:1], bs)
+		if err != nil {
+			return nil, nil, err
+		}
+		a2, b2, err := transformOps(as[1:], b1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return append(a1, a2...), b2, nil
+	default:
+		a1, b1, err := transformOps(as, bs[:1])
+		if err != nil {
+			return nil, nil, err
+		}
+		a2, b2, err := transformOps(a1, bs[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		return a2, append(b1, b2...), nil
+	}
+}
+
+func transformedPatch(ops []*transformOp) Patch {
+	p := make(Patch, 0, len(ops))
+	for _, t := range ops {
+		// Adding a member first removes it whether it existed or not.
+		if t.kind == "clear" {
+			p = append(p, newValueOperation("add", joinPointer(t.path), rawJSONNull), newOperation("remove", joinPointer(t.path)))
+			continue
+		}
+		p = append(p, t.operation())
+	}
+	return p
+}
+
+// transformOp is an operation with its paths split into encoded tokens. Its
+// kind may also be "clear", which removes a member that might not exist.
+type transformOp struct {
+	op   Operation
+	kind string
+	path []string
+	from []string
+}
+
+func decodeTransformOps(p Patch) ([]*transformOp, error) {
+	ops := make([]*transformOp, 0, len(p))
+
+	for _, op := range p {
+		t := &transformOp{op: op, kind: op.Kind()}
+
+		path, err := op.Path()
+		if err != nil {
+			return nil, err
+		}
+
+		if t.path, err = splitPointer(path); err != nil {
+			return nil, err
+		}
+
+		if t.kind == "move" || t.kind == "copy" {
+			from, err := op.From()
+			if err != nil {
+				return nil, err
+			}
+
+			if t.from, err = splitPointer(from); err != nil {
+				return nil, err
+			}
+		}
+
+		ops = append(ops, t)
+	}
+
+	return ops, nil
+}
+
+func splitPointer(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+
+	if path[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON Pointer: %q: %w", path, ErrInvalid)
+	}
+
+	return strings.Split(path[1:], "/"), nil
+}
+
+func joinPointer(tokens []string) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	return "/" + strings.Join(tokens, "/")
+}
+
+func (t *transformOp) operation() Operation {
+	op := make(Operation, len(t.op))
+	for k, v := range t.op {
+		op[k] = v
+	}
+
+	op["op"] = rawString(t.kind)
+	op["path"] = rawString(joinPointer(t.path))
+	if t.from != nil {
+		op["from"] = rawString(joinPointer(t.from))
+	}
+
+	return op
+}
+
+// rebaseOp returns x rebased onto a document y was applied to, which is
+// empty if x no longer applies. left tells whether x wins over y.
+func rebaseOp(x, y *transformOp, left bool) []*transformOp {
+	// A move to where the value already is changes nothing.
+	if x.kind == "move" && equalTokens(x.from, x.path) {
+		return nil
+	}
+
+	if y.kind == "move" && equalTokens(y.from, y.path) {
+		return []*transformOp{x}
+	}
+
+	// x destroying the value y moved means it has to go from where y put it
+	// as well. The document is then as if y had removed the value, and
+	// removed the member it overwrote, if any.
+	if y.kind == "move" {
+		if _, res := mapPath(y.from, false, x, !left); res == mapDestroyed {
+			from, kept := x.from, true
+			if x.from != nil {
+				from, res = mapPath(x.from, false, y, left)
+				kept = res != mapDestroyed
+			}
+			moved := &transformOp{op: x.op, kind: x.kind, path: x.path, from: from}
+
+			// Unless x overwrites that member itself, with a value y left in
+			// place.
+			if kept && writes(x) && equalTokens(x.path, y.path) && !isArrayPosition(y.path) {
+				return []*transformOp{moved}
+			}
+
+			// Or x moves part of the value out of it first, and then removes
+			// the rest, all of which is gone if y overwrote the destination.
+			if x.kind == "move" && hasTokenPrefix(x.from, y.from) {
+				removal := &transformOp{kind: "remove", path: elementPath(y.path)}
+
+				path, res := mapPath(x.path, true, y, left)
+				if res == mapDestroyed {
+					return []*transformOp{removal}
+				}
+				moved.path = path
+
+				if hasTokenPrefix(y.path, x.path) {
+					return []*transformOp{moved}
+				}
+				return []*transformOp{moved, removal}
+			}
+
+			removed := []*transformOp{{kind: "remove", path: y.from}}
+			if !isArrayPosition(y.path) {
+				removed = append(removed, &transformOp{kind: "clear", path: y.path})
+			}
+
+			xs := []*transformOp{x}
+			for _, z := range removed {
+				var next []*transformOp
+				for _, x := range xs {
+					next = append(next, rebaseOp(x, z, left)...)
+				}
+				xs = next
+			}
+
+			removal := &transformOp{kind: "remove", path: elementPath(y.path)}
+			return append([]*transformOp{removal}, xs...)
+		}
+	}
+
+	x2 := &transformOp{op: x.op, kind: x.kind, path: x.path, from: x.from}
+
+	sourceGone := false
+
+	if x.from != nil {
+		from, res := mapPath(x.from, false, y, left)
+		sourceGone = res == mapDestroyed
+
+		// Both moved the same value, only one of them can. The other still
+		// overwrote its destination.
+		if x.kind == "move" && y.kind == "move" && equalTokens(x.from, y.from) && !left {
+			sourceGone = true
+		}
+
+		x2.from = from
+	}
+
+	// The destination of a move is relative to the document without the
+	// moved value, so y has to be brought into that document first, unless
+	// it took the value itself.
+	yy := []*transformOp{y}
+	if x.kind == "move" && !(sourceGone && y.kind == "move" && equalTokens(x.from, y.from)) {
+		// A value y moves out of the one x moves is still inserted at its
+		// destination.
+		inserted := y
+		if y.kind == "move" && len(y.from) > len(x.from) && hasTokenPrefix(y.from, x.from) {
+			inserted = &transformOp{kind: "add", path: y.path}
+		}
+		yy = rebaseOp(inserted, &transformOp{kind: "remove", path: x.from}, !left)
+	}
+
+	gap := x.kind == "add" || x.kind == "copy" || x.kind == "move" || x.kind == "clear"
+
+	// Adding a member y moved away replaces it, the value follows the move.
+	if x.kind == "add" && y.kind == "move" && equalTokens(x.path, y.from) && !isArrayPosition(x.path) {
+		x2.kind = "replace"
+		gap = false
+	}
+
+	// And replacing a member y cleared adds it again.
+	if x.kind == "replace" && y.kind == "clear" && equalTokens(x.path, y.path) {
+		x2.kind = "add"
+		gap = true
+	}
+
+	path := x.path
+	var res mapResult
+	for _, y := range yy {
+		path, res = mapPath(path, gap, y, left)
+
+		if res == mapDestroyed || res == mapSame && !left && x2.kind != "remove" && x2.kind != "test" {
+			// The value x moves is still gone from where it was.
+			if x.kind == "move" && !sourceGone {
+				return []*transformOp{{kind: "remove", path: x2.from}}
+			}
+			return nil
+		}
+	}
+
+	if sourceGone {
+		// A move onto a member overwrites it, and the other side removes
+		// the moved value together with the member, unless it wrote the
+		// member itself.
+		if x.kind == "move" && !isArrayPosition(path) && len(path) > 0 && res != mapSame {
+			return []*transformOp{{kind: "clear", path: path}}
+		}
+		return nil
+	}
+
+	x2.path = path
+
+	// Writing a member y moved into an array replaces the element it
+	// became, by inserting before the element and then removing it.
+	if (x.kind == "copy" || x.kind == "move") && y.kind == "move" && equalTokens(x.path, y.from) && !isArrayPosition(x.path) && isArrayPosition(path) {
+		idx, _ := parseArrayIndex(path[len(path)-1], false)
+		if idx.fromEnd {
+			idx.n++
+		}
+		x2.path = replaceToken(path, len(path)-1, idx.token(true))
+
+		element, _ := mapInsert(path, false, x2.path, left)
+		return []*transformOp{x2, {kind: "remove", path: element}}
+	}
+
+	return []*transformOp{x2}
+}
+
+// writes reports whether x sets the value at its path.
+func writes(x *transformOp) bool {
+	switch x.kind {
+	case "add", "replace", "copy", "move":
+		return true
+	}
+
+	return false
+}
+
+// copyConflict reports whether x changes the value that y copies, in which
+// case neither can be rebased without knowing the value.
+func copyConflict(x, y *transformOp) bool {
+	if y.kind != "copy" {
+		return false
+	}
+
+	var written [][]string
+
+	switch x.kind {
+	case "add", "remove", "replace", "copy", "clear":
+		written = [][]string{x.path}
+	case "move":
+		written = [][]string{x.from, x.path}
+	}
+
+	for _, w := range written {
+		if hasTokenPrefix(w, y.from) || hasTokenPrefix(y.from, w) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// elementPath returns the path of the element inserted at path.
+func elementPath(path []string) []string {
+	if len(path) == 0 {
+		return path
+	}
+
+	idx, ok := parseArrayIndex(path[len(path)-1], true)
+	if !ok {
+		return path
+	}
+
+	return replaceToken(path, len(path)-1, idx.token(false))
+}
+
+func isArrayPosition(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+
+	_, ok := parseArrayIndex(path[len(path)-1], true)
+	return ok
+}
+
+type mapResult int
+
+const (
+	mapKept mapResult = iota
+	// mapDestroyed means the location no longer exists.
+	mapDestroyed
+	// mapSame means the location is the one the other operation wrote to.
+	mapSame
+)
+
+// mapPath maps the location q through the changes made by y. If gap is set
+// and the last token of q is an array index, q is an insertion position
+// rather than an element.
+func mapPath(q []string, gap bool, y *transformOp, left bool) ([]string, mapResult) {
+	switch y.kind {
+	case "add", "copy":
+		if len(y.path) == 0 {
+			return mapSet(q, gap, y.path)
+		}
+		return mapInsert(q, gap, y.path, left)
+	case "remove":
+		if len(y.path) == 0 {
+			return mapSet(q, gap, y.path)
+		}
+		return mapDelete(q, gap, y.path)
+	case "replace":
+		return mapSet(q, gap, y.path)
+	case "clear":
+		return mapClear(q, gap, y.path)
+	case "move":
+		if equalTokens(y.from, y.path) || len(y.from) == 0 {
+			return q, mapKept
+		}
+		return mapRelocate(q, gap, y.from, y.path, left)
+	}
+
+	return q, mapKept
+}
+
+// mapInsert maps q through an insertion into an array, or a write to an
+// object member, at p.
+func mapInsert(q []string, gap bool, p []string, left bool) ([]string, mapResult) {
+	d := len(p) - 1
+	if len(q) <= d || !equalTokens(q[:d], p[:d]) {
+		return q, mapKept
+	}
+
+	if pi, ok := parseArrayIndex(p[d], true); ok {
+		isGap := gap && len(q) == d+1
+
+		qi, ok := parseArrayIndex(q[d], isGap)
+		if !ok || qi.fromEnd != pi.fromEnd {
+			return q, mapKept
+		}
+
+		// The insertion of the left side comes first, which means it
+		// shifts when counting from the end.
+		if qi.n > pi.n || qi.n == pi.n && (!isGap || left == qi.fromEnd) {
+			qi.n++
+		}
+
+		return replaceToken(q, d, qi.token(isGap)), mapKept
+	}
+
+	if q[d] != p[d] {
+		return q, mapKept
+	}
+
+	if len(q) == d+1 {
+		return q, mapSame
+	}
+
+	return q, mapDestroyed
+}
+
+// mapDelete maps q through the removal of p.
+func mapDelete(q []string, gap bool, p []string) ([]string, mapResult) {
+	d := len(p) - 1
+	if len(q) <= d || !equalTokens(q[:d], p[:d]) {
+		return q, mapKept
+	}
+
+	isGap := gap && len(q) == d+1
+
+	if pi, ok := parseArrayIndex(p[d], false); ok {
+		qi, ok := parseArrayIndex(q[d], isGap)
+		if !ok || qi.fromEnd != pi.fromEnd {
+			return q, mapKept
+		}
+
+		if !isGap && qi.n == pi.n {
+			return q, mapDestroyed
+		}
+
+		if qi.n > pi.n {
+			qi.n--
+		}
+
+		return replaceToken(q, d, qi.token(isGap)), mapKept
+	}
+
+	if q[d] != p[d] {
+		return q, mapKept
+	}
+
+	return q, mapDestroyed
+}
+
+// mapSet maps q through the replacement of the value at p.
+func mapSet(q []string, gap bool, p []string) ([]string, mapResult) {
+	if equalTokens(q, p) {
+		if len(q) > 0 && gap {
+			if _, ok := parseArrayIndex(q[len(q)-1], true); ok {
+				return q, mapKept
+			}
+		}
+		return q, mapSame
+	}
+
+	if len(q) > len(p) && equalTokens(q[:len(p)], p) {
+		return q, mapDestroyed
+	}
+
+	return q, mapKept
+}
+
+// mapClear maps q through the removal of the member p, which might not have
+// existed.
+func mapClear(q []string, gap bool, p []string) ([]string, mapResult) {
+	if !hasTokenPrefix(q, p) {
+		return q, mapKept
+	}
+
+	if gap && len(q) == len(p) {
+		return q, mapSame
+	}
+
+	return q, mapDestroyed
+}
+
+// mapRelocate maps q through a move from one location to another. Locations
+// within the moved value follow it.
+func mapRelocate(q []string, gap bool, from, to []string, left bool) ([]string, mapResult) {
+	if hasTokenPrefix(q, from) && !(gap && len(q) == len(from) && isArrayPosition(q)) {
+		dest := make([]string, 0, len(to)+len(q)-len(from))
+		dest = append(dest, elementPath(to)...)
+		return append(dest, q[len(from):]...), mapKept
+	}
+
+	q, res := mapDelete(q, gap, from)
+	if res != mapKept {
+		return q, res
+	}
+
+	return mapInsert(q, gap, to, left)
+}
+
+// arrayIndex is a position in an array, either an element or the gap before
+// the element with the same index. When fromEnd is set, n counts from the end
+// of the array, with the gap 0 being the end of the array and the element 0
+// being the last one.
+type arrayIndex struct {
+	n       int
+	fromEnd bool
+}
+
+func parseArrayIndex(token string, gap bool) (arrayIndex, bool) {
+	if token == "-" {
+		return arrayIndex{n: 0, fromEnd: true}, gap
+	}
+
+	if !isIndexToken(token) {
+		return arrayIndex{}, false
+	}
+
+	n, err := strconv.Atoi(token)
+	if err != nil {
+		return arrayIndex{}, false
+	}
+
+	if n < 0 {
+		return arrayIndex{n: -n - 1, fromEnd: true}, true
+	}
+
+	return arrayIndex{n: n}, true
+}
+
+func (i arrayIndex) token(gap bool) string {
+	if !i.fromEnd {
+		return strconv.Itoa(i.n)
+	}
+
+	if gap && i.n == 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(-i.n - 1)
+}
+
+func replaceToken(tokens []string, i int, token string) []string {
+	replaced := make([]string, len(tokens))
+	copy(replaced, tokens)
+	replaced[i] = token
+	return replaced
+}
+
+// hasTokenPrefix reports whether prefix is, or is a parent of, tokens.
+func hasTokenPrefix(tokens, prefix []string) bool {
+	return len(tokens) >= len(prefix) && equalTokens(tokens[:len(prefix)], prefix)
+}
+
+func equalTokens(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,368 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var TransformCases = []struct {
+	doc, a, b, result string
+}{
+	{
+		`{"a": [1, 2, 3]}`,
+		`[{"op": "add", "path": "/a/-", "value": 4}]`,
+		`[{"op": "add", "path": "/a/-", "value": 5}]`,
+		`{"a": [1, 2, 3, 4, 5]}`,
+	},
+	{
+		`{"a": [1, 2, 3]}`,
+		`[{"op": "add", "path": "/a/1", "value": 4}]`,
+		`[{"op": "add", "path": "/a/1", "value": 5}]`,
+		`{"a": [1, 4, 5, 2, 3]}`,
+	},
+	{
+		`{"a": [1, 2, 3]}`,
+		`[{"op": "remove", "path": "/a/0"}]`,
+		`[{"op": "replace", "path": "/a/2", "value": 4}]`,
+		`{"a": [2, 4]}`,
+	},
+	{
+		`{"a": [1, 2, 3]}`,
+		`[{"op": "remove", "path": "/a/1"}]`,
+		`[{"op": "replace", "path": "/a/1", "value": 4}]`,
+		`{"a": [1, 3]}`,
+	},
+	{
+		`{"a": [1, 2, 3]}`,
+		`[{"op": "remove", "path": "/a/1"}]`,
+		`[{"op": "remove", "path": "/a/1"}]`,
+		`{"a": [1, 3]}`,
+	},
+	{
+		`{"a": [{"b": 1}, {"b": 2}]}`,
+		`[{"op": "add", "path": "/a/0", "value": {"b": 0}}]`,
+		`[{"op": "replace", "path": "/a/1/b", "value": 3}]`,
+		`{"a": [{"b": 0}, {"b": 1}, {"b": 3}]}`,
+	},
+	{
+		`{"a": {"b": 1}}`,
+		`[{"op": "remove", "path": "/a"}]`,
+		`[{"op": "add", "path": "/a/c", "value": 2}]`,
+		`{}`,
+	},
+	{
+		`{"a": 1}`,
+		`[{"op": "replace", "path": "/a", "value": 2}]`,
+		`[{"op": "replace", "path": "/a", "value": 3}]`,
+		`{"a": 2}`,
+	},
+	{
+		`{"a": 1}`,
+		`[{"op": "replace", "path": "/a", "value": 2}]`,
+		`[{"op": "remove", "path": "/a"}]`,
+		`{}`,
+	},
+	{
+		`{"a": {"b": 1}, "c": {}}`,
+		`[{"op": "move", "from": "/a", "path": "/c/a"}]`,
+		`[{"op": "add", "path": "/a/d", "value": 2}]`,
+		`{"c": {"a": {"b": 1, "d": 2}}}`,
+	},
+	{
+		`{"a": 1, "b": 2}`,
+		`[{"op": "move", "from": "/a", "path": "/c"}]`,
+		`[{"op": "move", "from": "/a", "path": "/d"}]`,
+		`{"b": 2, "c": 1}`,
+	},
+	{
+		`{"a": [1, 2, 3]}`,
+		`[{"op": "move", "from": "/a/0", "path": "/a/-"}]`,
+		`[{"op": "add", "path": "/a/1", "value": 4}]`,
+		`{"a": [4, 2, 3, 1]}`,
+	},
+	{
+		`{"a": {"b": 1}, "c": 2}`,
+		`[{"op": "move", "from": "/a/b", "path": "/c"}]`,
+		`[{"op": "remove", "path": "/a"}]`,
+		`{}`,
+	},
+	{
+		`{"a": 1, "b": 2}`,
+		`[{"op": "add", "path": "/c", "value": 3}]`,
+		`[{"op": "move", "from": "/a", "path": "/c"}]`,
+		`{"b": 2, "c": 3}`,
+	},
+	{
+		`{"b": true, "f~g": false}`,
+		`[{"op": "move", "from": "/b", "path": "/f~0g"}]`,
+		`[{"op": "remove", "path": "/f~0g"}]`,
+		`{}`,
+	},
+	{
+		`{"c": 1, "f~g": 2}`,
+		`[{"op": "remove", "path": "/c"}]`,
+		`[{"op": "move", "from": "/f~0g", "path": "/c"}]`,
+		`{}`,
+	},
+	{
+		`{"d/e": [1]}`,
+		`[{"op": "move", "from": "/d~1e/0", "path": "/d~1e"}]`,
+		`[{"op": "replace", "path": "/d~1e", "value": 2}]`,
+		`{"d/e": 2}`,
+	},
+	{
+		`{"a": [{"b": 1}, {"c": 2}]}`,
+		`[{"op": "move", "from": "/a/0", "path": "/n"}]`,
+		`[{"op": "move", "from": "/a/0/b", "path": "/a"}]`,
+		`{"a": 1}`,
+	},
+}
+
+func TestTransform(t *testing.T) {
+	for _, c := range TransformCases {
+		a, err := DecodePatch([]byte(c.a))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.a, err)
+		}
+
+		b, err := DecodePatch([]byte(c.b))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.b, err)
+		}
+
+		a2, b2, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("Unable to transform %s and %s: %s", c.a, c.b, err)
+		}
+
+		for _, order := range []Patch{append(a, b2...), append(b, a2...)} {
+			out, err := order.Apply([]byte(c.doc))
+			if err != nil {
+				t.Fatalf("Unable to apply transformed patches of %s and %s: %s", c.a, c.b, err)
+			}
+
+			if !compareJSON(string(out), c.result) {
+				t.Errorf("Transforming %s and %s: expected %s, got %s", c.a, c.b, reformatJSON(c.result), reformatJSON(string(out)))
+			}
+		}
+	}
+}
+
+func TestTransformCopyConflict(t *testing.T) {
+	a, _ := DecodePatch([]byte(`[{"op": "replace", "path": "/a/b", "value": 2}]`))
+	b, _ := DecodePatch([]byte(`[{"op": "copy", "from": "/a", "path": "/c"}]`))
+
+	if _, _, err := Transform(a, b); !errors.Is(err, ErrCopyConflict) {
+		t.Errorf("Expected ErrCopyConflict, got %v", err)
+	}
+}
+
+func TestTransformFromEndIndices(t *testing.T) {
+	doc := []byte(`{"a": [1, 2, 3], "b": {"-1": 4}}`)
+
+	cases := []struct {
+		a, b, result string
+	}{
+		{
+			`[{"op": "remove", "path": "/a/-1"}]`,
+			`[{"op": "remove", "path": "/a/2"}]`,
+			`{"a": [1, 2], "b": {"-1": 4}}`,
+		},
+		{
+			`[{"op": "add", "path": "/a/-1", "value": 5}]`,
+			`[{"op": "replace", "path": "/a/2", "value": 6}]`,
+			`{"a": [1, 2, 6, 5], "b": {"-1": 4}}`,
+		},
+		{
+			`[{"op": "move", "from": "/a/-3", "path": "/c"}]`,
+			`[{"op": "remove", "path": "/a/0"}]`,
+			`{"a": [2, 3], "b": {"-1": 4}}`,
+		},
+		{
+			`[{"op": "replace", "path": "/b/-1", "value": 5}]`,
+			`[{"op": "remove", "path": "/a/-1"}]`,
+			`{"a": [1, 2], "b": {"-1": 5}}`,
+		},
+	}
+
+	for _, c := range cases {
+		a, _ := DecodePatch([]byte(c.a))
+		b, _ := DecodePatch([]byte(c.b))
+
+		if _, _, err := Transform(a, b); !errors.Is(err, ErrInvalidIndex) {
+			t.Errorf("Transforming %s and %s: expected ErrInvalidIndex, got %v", c.a, c.b, err)
+		}
+
+		for _, pair := range [][2]Patch{{a, b}, {b, a}} {
+			x2, y2, err := TransformDocument(doc, pair[0], pair[1])
+			if err != nil {
+				t.Fatalf("Unable to transform %s and %s: %s", c.a, c.b, err)
+			}
+
+			xy, errXY := append(pair[0], y2...).Apply(doc)
+			yx, errYX := append(pair[1], x2...).Apply(doc)
+
+			if errXY != nil || errYX != nil || !compareJSON(string(xy), string(yx)) || !compareJSON(string(xy), c.result) {
+				t.Errorf("Transforming %s and %s: expected %s in both orders, got %s (%v) and %s (%v)", c.a, c.b, c.result, xy, errXY, yx, errYX)
+			}
+		}
+	}
+}
+
+func TestTransformInvalidPath(t *testing.T) {
+	a, _ := DecodePatch([]byte(`[{"op": "remove", "path": "a"}]`))
+
+	if _, _, err := Transform(a, Patch{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid, got %v", err)
+	}
+}
+
+// randomValue returns a random JSON value, nested at most depth levels.
+func randomValue(r *rand.Rand, depth int) interface{} {
+	keys := []string{"a", "b", "c/d", "e~f"}
+
+	switch n := r.Intn(4); {
+	case depth > 0 && n == 0:
+		obj := map[string]interface{}{}
+		for i := r.Intn(3); i >= 0; i-- {
+			obj[keys[r.Intn(len(keys))]] = randomValue(r, depth-1)
+		}
+		return obj
+	case depth > 0 && n == 1:
+		ary := []interface{}{}
+		for i := r.Intn(4); i > 0; i-- {
+			ary = append(ary, randomValue(r, depth-1))
+		}
+		return ary
+	default:
+		return r.Intn(10)
+	}
+}
+
+// randomPaths returns the pointers of the values in v, and of the locations
+// a value can be added at. Appending with "-" is left out, as Transform
+// assumes indices counted from the end and from the start of an array refer
+// to different elements.
+func randomPaths(v interface{}, prefix string) (existing, addable []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			path := prefix + "/" + encodePatchKey(k)
+			e, a := randomPaths(child, path)
+			existing = append(append(existing, path), e...)
+			addable = append(append(addable, path), a...)
+		}
+		addable = append(addable, prefix+"/g")
+	case []interface{}:
+		for i, child := range v {
+			path := prefix + "/" + strconv.Itoa(i)
+			e, a := randomPaths(child, path)
+			existing = append(append(existing, path), e...)
+			addable = append(append(addable, path), a...)
+		}
+		addable = append(addable, prefix+"/"+strconv.Itoa(len(v)))
+	}
+
+	sort.Strings(existing)
+	sort.Strings(addable)
+	return existing, addable
+}
+
+// randomPatch returns a random patch of up to n operations that applies to
+// doc.
+func randomPatch(r *rand.Rand, doc []byte, n int) string {
+	var ops []string
+
+	for tries := 0; len(ops) < n && tries < 100; tries++ {
+		var v interface{}
+		if err := json.Unmarshal(doc, &v); err != nil {
+			panic(err)
+		}
+
+		existing, addable := randomPaths(v, "")
+		if len(existing) == 0 {
+			break
+		}
+
+		from := existing[r.Intn(len(existing))]
+		path := addable[r.Intn(len(addable))]
+
+		var op string
+		switch r.Intn(5) {
+		case 0:
+			op = fmt.Sprintf(`{"op": "add", "path": %q, "value": %d}`, path, r.Intn(10))
+		case 1:
+			op = fmt.Sprintf(`{"op": "remove", "path": %q}`, from)
+		case 2:
+			op = fmt.Sprintf(`{"op": "replace", "path": %q, "value": %d}`, from, r.Intn(10))
+		case 3:
+			op = fmt.Sprintf(`{"op": "copy", "from": %q, "path": %q}`, from, path)
+		default:
+			// A value cannot be moved into one of its children.
+			if strings.HasPrefix(path, from+"/") {
+				continue
+			}
+			op = fmt.Sprintf(`{"op": "move", "from": %q, "path": %q}`, from, path)
+		}
+
+		p, err := DecodePatch([]byte("[" + op + "]"))
+		if err != nil {
+			panic(err)
+		}
+
+		out, err := p.Apply(doc)
+		if err != nil {
+			continue
+		}
+
+		ops = append(ops, op)
+		doc = out
+	}
+
+	return "[" + strings.Join(ops, ", ") + "]"
+}
+
+func TestTransformConverges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		doc, err := json.Marshal(map[string]interface{}{"a": randomValue(r, 3), "b": randomValue(r, 2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pa := randomPatch(r, doc, 1+r.Intn(2))
+		pb := randomPatch(r, doc, 1+r.Intn(2))
+
+		a, err := DecodePatch([]byte(pa))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", pa, err)
+		}
+
+		b, err := DecodePatch([]byte(pb))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", pb, err)
+		}
+
+		a2, b2, err := Transform(a, b)
+		if errors.Is(err, ErrCopyConflict) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unable to transform %s and %s: %s", pa, pb, err)
+		}
+
+		ab, errAB := append(a, b2...).Apply(doc)
+		ba, errBA := append(b, a2...).Apply(doc)
+
+		if errAB != nil || errBA != nil || !compareJSON(string(ab), string(ba)) {
+			t.Errorf("Transforming %s and %s on %s: expected both orders to give the same document, got %s (%v) and %s (%v)", pa, pb, doc, ab, errAB, ba, errBA)
+		}
+	}
+}
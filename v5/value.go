@@ -0,0 +1,98 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+
+	"github.com/linux019/json-patch/v5/internal/json"
+)
+
+// ApplyToValue applies the patch p to the Go value v points to, such as a
+// struct or a map, as Patch.ApplyToValueWithOptions does with the default
+// options.
+func ApplyToValue(p Patch, v any) error {
+	return p.ApplyToValueWithOptions(v, NewApplyOptions())
+}
+
+// ApplyToValue applies the patch to the Go value v points to, as the
+// ApplyToValue function does.
+func (p Patch) ApplyToValue(v any) error {
+	return ApplyToValue(p, v)
+}
+
+// ApplyToValueWithOptions applies the patch to the JSON encoding of the Go
+// value v points to, honoring its `json` struct tags, and decodes the result
+// back into it. The patched document must not hold members the struct types
+// of v have no field for. Fields that are not part of the JSON encoding, such
+// as unexported fields and fields tagged `json:"-"`, keep their values. If
+// the patch fails to apply or its result does not decode, v is unchanged.
+func (p Patch) ApplyToValueWithOptions(v any, options *ApplyOptions) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cannot apply a patch to %T, which is not a non-nil pointer: %w", v, ErrInvalid)
+	}
+
+	doc, err := json.MarshalEscaped(v, options.EscapeHTML)
+	if err != nil {
+		return err
+	}
+
+	out, err := p.ApplyWithOptions(doc, options)
+	if err != nil {
+		return err
+	}
+
+	decoded := reflect.New(rv.Elem().Type())
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(decoded.Interface()); err != nil {
+		return fmt.Errorf("failed to decode patched value: %w", err)
+	}
+
+	keepHiddenFields(rv.Elem(), decoded.Elem())
+	return nil
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// keepHiddenFields sets dst, which holds a value before a patch, to decoded,
+// the value after it, except for the fields of structs that are not part of
+// their JSON encoding and which the patch therefore left alone. Structs are
+// matched through fields and pointers, not through maps and slices.
+func keepHiddenFields(dst, decoded reflect.Value) {
+	t := decoded.Type()
+
+	switch {
+	case t.Implements(jsonUnmarshalerType), reflect.PointerTo(t).Implements(jsonUnmarshalerType),
+		t.Implements(textUnmarshalerType), reflect.PointerTo(t).Implements(textUnmarshalerType):
+	case t.Kind() == reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			if f.Tag.Get("json") == "-" || !f.IsExported() && !(f.Anonymous && f.Type.Kind() == reflect.Struct) {
+				continue
+			}
+
+			keepHiddenFields(dst.Field(i), decoded.Field(i))
+		}
+		return
+	case t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct && !dst.IsNil() && !decoded.IsNil():
+		// The struct is copied, rather than changed through the pointer,
+		// which other values may share.
+		p := reflect.New(t.Elem())
+		p.Elem().Set(dst.Elem())
+		keepHiddenFields(p.Elem(), decoded.Elem())
+		decoded = p
+	}
+
+	if dst.CanSet() {
+		dst.Set(decoded)
+	}
+}
@@ -0,0 +1,134 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type valueSpec struct {
+	Replicas int               `json:"replicas"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	cache    string
+}
+
+type valueMeta struct {
+	Owner string `json:"owner"`
+}
+
+type valueDoc struct {
+	valueMeta
+	Name    string     `json:"name"`
+	Tags    []string   `json:"tags"`
+	Spec    *valueSpec `json:"spec,omitempty"`
+	Updated time.Time  `json:"updated"`
+	Secret  string     `json:"-"`
+	version int
+}
+
+func TestApplyToValue(t *testing.T) {
+	spec := &valueSpec{Replicas: 1, Labels: map[string]string{"a": "1", "b": "2"}, cache: "c"}
+
+	v := valueDoc{
+		valueMeta: valueMeta{Owner: "me"},
+		Name:      "foo",
+		Tags:      []string{"x", "y"},
+		Spec:      spec,
+		Secret:    "s",
+		version:   3,
+	}
+
+	patch := `[
+		{"op": "replace", "path": "/name", "value": "bar"},
+		{"op": "remove", "path": "/tags/0"},
+		{"op": "replace", "path": "/spec/replicas", "value": 3},
+		{"op": "remove", "path": "/spec/labels/a"},
+		{"op": "replace", "path": "/owner", "value": "you"},
+		{"op": "replace", "path": "/updated", "value": "2024-01-02T03:04:05Z"}
+	]`
+
+	p, err := DecodePatch([]byte(patch))
+	if err != nil {
+		t.Fatalf("Unable to decode patch %s: %s", patch, err)
+	}
+
+	if err := ApplyToValue(p, &v); err != nil {
+		t.Fatalf("Unable to apply: %s", err)
+	}
+
+	expected := valueDoc{
+		valueMeta: valueMeta{Owner: "you"},
+		Name:      "bar",
+		Tags:      []string{"y"},
+		Spec:      &valueSpec{Replicas: 3, Labels: map[string]string{"b": "2"}, cache: "c"},
+		Updated:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Secret:    "s",
+		version:   3,
+	}
+
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, v)
+	}
+
+	if spec.Replicas != 1 || len(spec.Labels) != 2 {
+		t.Errorf("Expected the struct the value pointed to be left alone, got %+v", spec)
+	}
+}
+
+func TestApplyToValueMap(t *testing.T) {
+	v := map[string]interface{}{"a": 1, "b": []interface{}{"x"}}
+
+	patch := `[{"op": "remove", "path": "/a"}, {"op": "add", "path": "/b/-", "value": 2}]`
+
+	p, err := DecodePatch([]byte(patch))
+	if err != nil {
+		t.Fatalf("Unable to decode patch %s: %s", patch, err)
+	}
+
+	if err := p.ApplyToValue(&v); err != nil {
+		t.Fatalf("Unable to apply: %s", err)
+	}
+
+	expected := map[string]interface{}{"b": []interface{}{"x", float64(2)}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("Expected %v, got %v", expected, v)
+	}
+}
+
+func TestApplyToValueErrors(t *testing.T) {
+	cases := []struct {
+		patch string
+		err   error
+	}{
+		{`[{"op": "add", "path": "/unknown", "value": 1}]`, nil},
+		{`[{"op": "replace", "path": "/name", "value": 1}]`, nil},
+		{`[{"op": "remove", "path": "/missing"}]`, ErrMissing},
+		{`[{"op": "replace", "path": "/name", "value": "bar"}, {"op": "test", "path": "/name", "value": "baz"}]`, ErrTestFailed},
+	}
+
+	for _, c := range cases {
+		v := valueDoc{Name: "foo", Secret: "s"}
+		expected := v
+
+		p, err := DecodePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("Unable to decode patch %s: %s", c.patch, err)
+		}
+
+		err = p.ApplyToValue(&v)
+		if err == nil || c.err != nil && !errors.Is(err, c.err) {
+			t.Errorf("Applying %s: expected %v, got %v", c.patch, c.err, err)
+		}
+
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("Applying %s: expected the value to be unchanged, got %+v", c.patch, v)
+		}
+	}
+
+	for _, v := range []interface{}{valueDoc{}, (*valueDoc)(nil), nil} {
+		if err := ApplyToValue(Patch{}, v); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %T to be rejected, got %v", v, err)
+		}
+	}
+}